@@ -2,18 +2,101 @@ package main
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
+	"google.golang.org/grpc/codes"
 )
 
 type config struct {
 	Addr              string        `env:"HTTP_LISTEN_ADDR" env-default:":8080"`
+	GRPCAddr          string        `env:"GRPC_LISTEN_ADDR" env-default:":9090" env-description:"Server registry"`
+	RegistryToken     string        `env:"REGISTRY_TOKEN" env-description:"Storage servers token, unset refuses all"`
+	AdminAddr         string        `env:"ADMIN_LISTEN_ADDR" env-default:":8081" env-description:"Admin API"`
+	AdminToken        string        `env:"ADMIN_TOKEN" env-description:"Bearer token of /admin/, unset disables it"`
+	HeartbeatInterval time.Duration `env:"HEARTBEAT_INTERVAL" env-default:"10s"`
+	StaleAfter        time.Duration `env:"SERVER_STALE_AFTER" env-default:"30s"`
 	ConnectionTimeout time.Duration `env:"CONNECTION_TIMEOUT" env-default:"5s"`
+	KeepaliveTime     time.Duration `env:"CONNECTION_KEEPALIVE" env-default:"30s" env-description:"At least 10s"`
+	IdleTimeout       time.Duration `env:"CONNECTION_IDLE_TIMEOUT" env-default:"5m"`
+	FileLayout        string        `env:"FILE_LAYOUT" env-default:"replicated" env-description:"replicated or erasure"`
 	FileFragments     int           `env:"FILE_FRAGMENTS" env-default:"6"`
+	FileReplicas      int           `env:"FILE_REPLICAS" env-default:"1"`
+	ECDataShards      int           `env:"EC_DATA_SHARDS" env-default:"4"`
+	ECParityShards    int           `env:"EC_PARITY_SHARDS" env-default:"2"`
+	Placement         string        `env:"PLACEMENT" env-default:"least-used" env-description:"weighted-random|rendezvous"`
+	AntiAffinity      bool          `env:"PLACEMENT_ANTI_AFFINITY" env-default:"true"`
+	FailureDomain     string        `env:"FAILURE_DOMAIN" env-default:"rack" env-description:"server, rack or zone"`
+	UploadParallelism int           `env:"UPLOAD_PARALLELISM" env-default:"4"`
+	SpoolDir          string        `env:"SPOOL_DIR" env-description:"Temp files of uploads. Default: system temp dir"`
+	FragmentBuffer    int64         `env:"FRAGMENT_BUFFER_SIZE" env-default:"67108864" env-description:"Default: 64 MB"`
+	PrefetchDepth     int           `env:"PREFETCH_DEPTH" env-default:"4"`
+	PrefetchMemory    int64         `env:"PREFETCH_MEMORY" env-default:"268435456" env-description:"Default: 256 MB"`
 	FileSizeLimit     int64         `env:"FILE_SIZE_LIMIT" env-default:"10737418240" env-description:"Default: 10 GB"`
+	DownloadTimeout   time.Duration `env:"DOWNLOAD_TIMEOUT" env-default:"1h"`
 
-	PG pgConfig
+	Retry     retryConfig
+	Health    healthConfig
+	Rebalance rebalanceConfig
+	Repair    repairConfig
+	GC        gcConfig
+	Upload    uploadConfig
+	Deletion  deletionConfig
+	PG        pgConfig
+}
+
+type rebalanceConfig struct {
+	Enabled         bool          `env:"REBALANCE_ENABLED" env-default:"true"`
+	Interval        time.Duration `env:"REBALANCE_INTERVAL" env-default:"1m"`
+	Threshold       float64       `env:"REBALANCE_THRESHOLD" env-default:"0.1" env-description:"Share of capacity"`
+	MovesPerRound   int           `env:"REBALANCE_MOVES_PER_ROUND" env-default:"100"`
+	Bandwidth       int64         `env:"REBALANCE_BANDWIDTH" env-default:"0" env-description:"Bytes/s, 0 means no limit"`
+	MaxAttempts     int           `env:"REBALANCE_MAX_ATTEMPTS" env-default:"5"`
+	FailedRetention time.Duration `env:"REBALANCE_FAILED_RETENTION" env-default:"1h"`
+}
+
+type repairConfig struct {
+	Enabled         bool          `env:"REPAIR_ENABLED" env-default:"true"`
+	Interval        time.Duration `env:"REPAIR_INTERVAL" env-default:"1m"`
+	DownAfter       time.Duration `env:"REPAIR_DOWN_AFTER" env-default:"15m"`
+	ScanInterval    time.Duration `env:"REPAIR_SCAN_INTERVAL" env-default:"24h"`
+	StatParallelism int           `env:"REPAIR_STAT_PARALLELISM" env-default:"8"`
+	MaxAttempts     int           `env:"REPAIR_MAX_ATTEMPTS" env-default:"5"`
+	FailedRetention time.Duration `env:"REPAIR_FAILED_RETENTION" env-default:"1h"`
+}
+
+type gcConfig struct {
+	Enabled     bool          `env:"GC_ENABLED" env-default:"true"`
+	Interval    time.Duration `env:"GC_INTERVAL" env-default:"6h"`
+	GracePeriod time.Duration `env:"GC_GRACE_PERIOD" env-default:"24h"`
+	DryRun      bool          `env:"GC_DRY_RUN" env-default:"false"`
+}
+
+type uploadConfig struct {
+	CleanupInterval time.Duration `env:"UPLOAD_CLEANUP_INTERVAL" env-default:"5m"`
+	AbandonAfter    time.Duration `env:"UPLOAD_ABANDON_AFTER" env-default:"1h"`
+}
+
+type deletionConfig struct {
+	Interval time.Duration `env:"FRAGMENT_DELETE_INTERVAL" env-default:"1m"`
+}
+
+type healthConfig struct {
+	Interval        time.Duration `env:"HEALTH_CHECK_INTERVAL" env-default:"5s"`
+	Timeout         time.Duration `env:"HEALTH_CHECK_TIMEOUT" env-default:"2s"`
+	FallThreshold   int           `env:"HEALTH_FALL_THRESHOLD" env-default:"3" env-description:"Failures to mark down"`
+	RiseThreshold   int           `env:"HEALTH_RISE_THRESHOLD" env-default:"2" env-description:"Successes to bring back"`
+	DegradedLatency time.Duration `env:"HEALTH_DEGRADED_LATENCY" env-default:"500ms"`
+}
+
+type retryConfig struct {
+	MaxAttempts    int           `env:"RETRY_MAX_ATTEMPTS" env-default:"3" env-description:"1 disables retries"`
+	InitialBackoff time.Duration `env:"RETRY_INITIAL_BACKOFF" env-default:"100ms"`
+	MaxBackoff     time.Duration `env:"RETRY_MAX_BACKOFF" env-default:"2s"`
+	Budget         time.Duration `env:"RETRY_BUDGET" env-default:"10s" env-description:"Per server, 0 means no limit"`
+	Codes          grpcCodes     `env:"RETRY_CODES" env-default:"UNAVAILABLE,RESOURCE_EXHAUSTED,ABORTED,DEADLINE_EXCEEDED"`
 }
 
 type pgConfig struct {
@@ -31,5 +114,28 @@ func newConfig() (config, error) {
 	if err := cleanenv.ReadEnv(&cfg); err != nil {
 		return cfg, fmt.Errorf("read config: %w", err)
 	}
+	if cfg.FileLayout != "replicated" && cfg.FileLayout != "erasure" {
+		return cfg, fmt.Errorf("read config: unknown FILE_LAYOUT %q", cfg.FileLayout)
+	}
 	return cfg, nil
 }
+
+// grpcCodes is a comma-separated list of gRPC code names, like UNAVAILABLE.
+type grpcCodes []codes.Code
+
+func (c *grpcCodes) SetValue(s string) error {
+	*c = grpcCodes{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+			return err
+		}
+		*c = append(*c, code)
+	}
+	return nil
+}
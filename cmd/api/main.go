@@ -4,14 +4,15 @@ import (
 	"context"
 	"log"
 	"log/slog"
-	nh "net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/ssimpl/simple-storage/internal/api/infrastructure/db/pg"
 	"github.com/ssimpl/simple-storage/internal/api/infrastructure/storage"
+	"github.com/ssimpl/simple-storage/internal/api/model"
 	"github.com/ssimpl/simple-storage/internal/api/service"
+	"github.com/ssimpl/simple-storage/internal/api/transport/grpc"
 	"github.com/ssimpl/simple-storage/internal/api/transport/http"
 )
 
@@ -30,9 +31,19 @@ func run() error {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	slog.SetDefault(logger)
 
-	slog.Info("Starting API server", "addr", cfg.Addr)
+	slog.Info("Starting API server", "addr", cfg.Addr, "grpc_addr", cfg.GRPCAddr)
+
+	storageClient := storage.NewClient(storage.Config{
+		ConnectionTimeout: cfg.ConnectionTimeout,
+		KeepaliveTime:     cfg.KeepaliveTime,
+		IdleTimeout:       cfg.IdleTimeout,
+	})
+	defer func() {
+		if err := storageClient.Close(); err != nil {
+			slog.Error("Close storage client error", "err", err)
+		}
+	}()
 
-	storageClient := storage.NewClient()
 	metaRepo, err := pg.NewDB(pg.Config{
 		Addr:     cfg.PG.Addr,
 		Database: cfg.PG.Database,
@@ -46,13 +57,124 @@ func run() error {
 		return err
 	}
 
-	objectManager := service.NewObjectManager(storageClient, metaRepo, cfg.FileFragments)
-	handler := http.NewHandler(objectManager, cfg.FileSizeLimit)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	registry := service.NewRegistry(metaRepo, service.RegistryConfig{
+		HeartbeatInterval: cfg.HeartbeatInterval,
+		StaleAfter:        cfg.StaleAfter,
+	})
+	go registry.Run(ctx)
+
+	healthChecker := service.NewHealthChecker(storageClient, metaRepo, service.HealthConfig{
+		Interval:        cfg.Health.Interval,
+		Timeout:         cfg.Health.Timeout,
+		FallThreshold:   cfg.Health.FallThreshold,
+		RiseThreshold:   cfg.Health.RiseThreshold,
+		DegradedLatency: cfg.Health.DegradedLatency,
+	})
+	go healthChecker.Run(ctx)
+
+	placement, err := service.NewPlacement(service.PlacementStrategy(cfg.Placement))
+	if err != nil {
+		return err
+	}
+	failureDomain, err := service.ParseFailureDomain(cfg.FailureDomain)
+	if err != nil {
+		return err
+	}
+
+	objectManager := service.NewObjectManager(storageClient, metaRepo, healthChecker, service.Config{
+		Layout:             model.LayoutScheme(cfg.FileLayout),
+		FragmentCount:      cfg.FileFragments,
+		Replicas:           cfg.FileReplicas,
+		DataShards:         cfg.ECDataShards,
+		ParityShards:       cfg.ECParityShards,
+		Placement:          placement,
+		AllowColocation:    !cfg.AntiAffinity,
+		FailureDomain:      failureDomain,
+		UploadParallelism:  cfg.UploadParallelism,
+		SpoolDir:           cfg.SpoolDir,
+		FragmentBufferSize: cfg.FragmentBuffer,
+		PrefetchDepth:      cfg.PrefetchDepth,
+		PrefetchMemory:     cfg.PrefetchMemory,
+		DownloadTimeout:    cfg.DownloadTimeout,
+		Retry: service.RetryPolicy{
+			MaxAttempts:    cfg.Retry.MaxAttempts,
+			InitialBackoff: cfg.Retry.InitialBackoff,
+			MaxBackoff:     cfg.Retry.MaxBackoff,
+			Budget:         cfg.Retry.Budget,
+			RetryableCodes: cfg.Retry.Codes,
+		},
+	})
+	// Draining servers rely on the rebalancer, so it runs with balancing disabled too.
+	rebalancer := service.NewRebalancer(storageClient, metaRepo, healthChecker, service.RebalanceConfig{
+		Interval:        cfg.Rebalance.Interval,
+		Threshold:       cfg.Rebalance.Threshold,
+		MovesPerRound:   cfg.Rebalance.MovesPerRound,
+		Bandwidth:       cfg.Rebalance.Bandwidth,
+		MaxAttempts:     cfg.Rebalance.MaxAttempts,
+		SourceRetention: cfg.DownloadTimeout,
+		FailedRetention: cfg.Rebalance.FailedRetention,
+		DrainOnly:       !cfg.Rebalance.Enabled,
+		AllowColocation: !cfg.AntiAffinity,
+		FailureDomain:   failureDomain,
+	})
+	go rebalancer.Run(ctx)
+
+	if cfg.Repair.Enabled {
+		repairer := service.NewRepairer(objectManager, storageClient, metaRepo, healthChecker, service.RepairConfig{
+			Interval:        cfg.Repair.Interval,
+			DownAfter:       cfg.Repair.DownAfter,
+			ScanInterval:    cfg.Repair.ScanInterval,
+			StatParallelism: cfg.Repair.StatParallelism,
+			MaxAttempts:     cfg.Repair.MaxAttempts,
+			FailedRetention: cfg.Repair.FailedRetention,
+		})
+		go repairer.Run(ctx)
+	}
 
-	mux := nh.NewServeMux()
-	mux.HandleFunc("/", handler.ServeHTTP)
+	sizeBackfiller := service.NewSizeBackfiller(storageClient, metaRepo)
+	go sizeBackfiller.Run(ctx)
 
-	server := http.NewServer(cfg.Addr, mux)
+	uploadCleaner := service.NewUploadCleaner(storageClient, metaRepo, service.UploadCleanupConfig{
+		Interval:     cfg.Upload.CleanupInterval,
+		AbandonAfter: cfg.Upload.AbandonAfter,
+	})
+	go uploadCleaner.Run(ctx)
+
+	fragmentDeleter := service.NewFragmentDeleter(storageClient, metaRepo, service.FragmentDeletionConfig{
+		Interval: cfg.Deletion.Interval,
+		// Downloads can't outlast their timeout, so the fragments they read are kept as long.
+		Delay: cfg.DownloadTimeout,
+	})
+	go fragmentDeleter.Run(ctx)
+
+	// The collector is also run on demand from the admin API, so it exists even when periodic runs are disabled.
+	garbageCollector := service.NewGarbageCollector(storageClient, metaRepo, healthChecker, service.GCConfig{
+		Interval:    cfg.GC.Interval,
+		GracePeriod: cfg.GC.GracePeriod,
+		DryRun:      cfg.GC.DryRun,
+	})
+	if cfg.GC.Enabled {
+		go garbageCollector.Run(ctx)
+	}
+
+	handler := http.NewHandler(objectManager, cfg.FileSizeLimit)
+	clusterManager := service.NewClusterManager(metaRepo, registry, healthChecker, failureDomain, cfg.FileReplicas)
+	adminHandler := http.NewAdminHandler(cfg.AdminToken, healthChecker, clusterManager, garbageCollector)
+	if cfg.AdminToken == "" {
+		slog.Warn("ADMIN_TOKEN is not set, the admin API refuses all requests")
+	}
+
+	server := http.NewServer(cfg.Addr, handler)
+	// The admin API has a listener of its own, so it doesn't take names from the object namespace
+	// and can be kept off the public network.
+	adminServer := http.NewServer(cfg.AdminAddr, adminHandler)
+	grpcServer := grpc.NewServer(cfg.GRPCAddr, cfg.RegistryToken, grpc.NewRegistryServer(registry))
+	if cfg.RegistryToken == "" {
+		slog.Warn("REGISTRY_TOKEN is not set, the registry refuses all storage servers")
+	}
 
 	go func() {
 		if err := server.Start(); err != nil {
@@ -60,8 +182,17 @@ func run() error {
 		}
 	}()
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer cancel()
+	go func() {
+		if err := adminServer.Start(); err != nil {
+			slog.Error("Start admin server error", "err", err)
+		}
+	}()
+
+	go func() {
+		if err := grpcServer.Start(); err != nil {
+			slog.Error("Start registry server error", "err", err)
+		}
+	}()
 
 	<-ctx.Done()
 
@@ -70,6 +201,10 @@ func run() error {
 	if err := server.Stop(); err != nil {
 		slog.Error("Stop API server error", "err", err)
 	}
+	if err := adminServer.Stop(); err != nil {
+		slog.Error("Stop admin server error", "err", err)
+	}
+	grpcServer.Stop()
 
 	slog.Info("API server stopped")
 
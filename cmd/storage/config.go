@@ -2,13 +2,34 @@ package main
 
 import (
 	"fmt"
+	"net"
+	"os"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
+
+	"github.com/ssimpl/simple-storage/internal/storage/model"
 )
 
 type config struct {
-	Addr        string `env:"GRPC_LISTEN_ADDR" env-default:":50051"`
-	StoragePath string `env:"STORAGE_PATH" env-default:"/storage"`
+	Addr            string            `env:"GRPC_LISTEN_ADDR" env-default:":50051"`
+	AdvertiseAddr   string            `env:"ADVERTISE_ADDR" env-description:"Default: hostname and listen port"`
+	StoragePath     string            `env:"STORAGE_PATH" env-default:"/storage"`
+	StorageCapacity int64             `env:"STORAGE_CAPACITY" env-description:"Bytes. Default: file system size"`
+	Labels          map[string]string `env:"STORAGE_LABELS" env-description:"Comma-separated key:value pairs"`
+	Zone            string            `env:"STORAGE_ZONE" env-description:"Sets the zone label"`
+	Rack            string            `env:"STORAGE_RACK" env-description:"Sets the rack label"`
+	RegistryAddr    string            `env:"REGISTRY_ADDR" env-default:"api:9090" env-description:"API server registry"`
+	RegistryToken   string            `env:"REGISTRY_TOKEN" env-description:"Shared token of the API server registry"`
+	RegistryTimeout time.Duration     `env:"REGISTRY_TIMEOUT" env-default:"5s"`
+
+	Scrub scrubConfig
+}
+
+type scrubConfig struct {
+	Enabled   bool          `env:"SCRUB_ENABLED" env-default:"true"`
+	Interval  time.Duration `env:"SCRUB_INTERVAL" env-default:"24h"`
+	Bandwidth int64         `env:"SCRUB_BANDWIDTH" env-default:"10485760" env-description:"Bytes/s, 0 means no limit"`
 }
 
 func newConfig() (config, error) {
@@ -16,5 +37,28 @@ func newConfig() (config, error) {
 	if err := cleanenv.ReadEnv(&cfg); err != nil {
 		return cfg, fmt.Errorf("read config: %w", err)
 	}
+
+	if cfg.AdvertiseAddr == "" {
+		_, port, err := net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			return cfg, fmt.Errorf("read config: invalid GRPC_LISTEN_ADDR: %w", err)
+		}
+		host, err := os.Hostname()
+		if err != nil {
+			return cfg, fmt.Errorf("read config: get hostname: %w", err)
+		}
+		cfg.AdvertiseAddr = net.JoinHostPort(host, port)
+	}
+
+	for key, value := range map[string]string{model.LabelZone: cfg.Zone, model.LabelRack: cfg.Rack} {
+		if value == "" {
+			continue
+		}
+		if cfg.Labels == nil {
+			cfg.Labels = make(map[string]string)
+		}
+		cfg.Labels[key] = value
+	}
+
 	return cfg, nil
 }
@@ -8,6 +8,8 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/ssimpl/simple-storage/internal/storage/infrastructure/registry"
+	"github.com/ssimpl/simple-storage/internal/storage/model"
 	"github.com/ssimpl/simple-storage/internal/storage/service"
 	"github.com/ssimpl/simple-storage/internal/storage/transport/grpc"
 )
@@ -27,9 +29,28 @@ func run() error {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	slog.SetDefault(logger)
 
-	slog.Info("Starting Storage server", "addr", cfg.Addr)
+	slog.Info("Starting Storage server", "addr", cfg.Addr, "advertise_addr", cfg.AdvertiseAddr)
 
 	objectStorage := service.NewObjectStorage(cfg.StoragePath)
+	if err := objectStorage.CleanupTempFiles(context.Background()); err != nil {
+		return err
+	}
+
+	serverID, err := objectStorage.ServerID()
+	if err != nil {
+		return err
+	}
+
+	registryClient, err := registry.NewClient(cfg.RegistryAddr, cfg.RegistryToken, cfg.RegistryTimeout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := registryClient.Close(); err != nil {
+			slog.Error("Close registry client error", "err", err)
+		}
+	}()
+
 	storageSrv := grpc.NewStorageServer(objectStorage)
 
 	server := grpc.NewServer(cfg.Addr, storageSrv)
@@ -43,6 +64,28 @@ func run() error {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
+	scrubber := service.NewScrubber(objectStorage, service.ScrubConfig{
+		Interval:  cfg.Scrub.Interval,
+		Bandwidth: cfg.Scrub.Bandwidth,
+	})
+	if cfg.Scrub.Enabled {
+		go scrubber.Run(ctx)
+	}
+
+	registration := service.NewRegistration(registryClient, objectStorage, model.Registration{
+		ServerID: serverID,
+		Addr:     cfg.AdvertiseAddr,
+		Capacity: cfg.StorageCapacity,
+		Labels:   cfg.Labels,
+	}, func() int64 {
+		capacity, err := objectStorage.Capacity()
+		if err != nil {
+			slog.Error("Failed to get storage capacity", "err", err)
+		}
+		return capacity
+	}, scrubber)
+	go registration.Run(ctx)
+
 	<-ctx.Done()
 
 	slog.Info("Shutting down Storage server")
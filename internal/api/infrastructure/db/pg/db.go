@@ -6,11 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/ssimpl/simple-storage/internal/api/infrastructure/db/pg/entity"
 	"github.com/ssimpl/simple-storage/internal/api/model"
 
+	"github.com/google/uuid"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/uptrace/bun/driver/pgdriver"
@@ -57,37 +59,154 @@ func NewDB(cfg Config) (*DB, error) {
 }
 
 func (db *DB) SaveObjectMeta(ctx context.Context, meta model.ObjectMeta) error {
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return saveObjectMeta(ctx, tx, meta)
+	}); err != nil {
+		return fmt.Errorf("run transaction: %w", err)
+	}
+
+	return nil
+}
+
+// saveObjectMeta inserts or replaces the object metadata and adds the space of its fragments to their servers.
+// The fragments of a replaced version have their space released and are queued for deletion,
+// so downloads that read its metadata can finish.
+func saveObjectMeta(ctx context.Context, tx bun.Tx, meta model.ObjectMeta) error {
 	e, err := entity.ObjectMetaFromModel(meta)
 	if err != nil {
 		return fmt.Errorf("convert object meta to db entity: %w", err)
 	}
 
-	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
-		_, err := tx.NewInsert().
-			Model(&e).
-			On("CONFLICT (name) DO UPDATE").
-			Set("fragments = EXCLUDED.fragments").
+	replaced, err := replaceObjectMeta(ctx, tx, &e)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range meta.Fragments {
+		res, err := tx.NewUpdate().
+			Model((*entity.Server)(nil)).
+			Set("used_space = used_space + ?", f.FragmentSize).
+			Where("id = ?", f.ServerID).
+			Exec(ctx)
+
+		if err != nil {
+			return fmt.Errorf("update server used space: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+
+		// The server may have been removed while the object was uploaded.
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return model.ErrServerNotFound
+		}
+	}
+
+	if replaced == nil {
+		return nil
+	}
+
+	return releaseFragments(ctx, tx, *replaced, meta.Fragments)
+}
+
+// replaceObjectMeta inserts the object metadata, or updates it and returns the version it replaced.
+// The replaced version is read with the row locked, so concurrent saves of the object replace each other in turn.
+func replaceObjectMeta(ctx context.Context, tx bun.Tx, e *entity.ObjectMeta) (*model.ObjectMeta, error) {
+	for {
+		res, err := tx.NewInsert().
+			Model(e).
+			On("CONFLICT (name) DO NOTHING").
 			Exec(ctx)
 
 		if err != nil {
-			return fmt.Errorf("insert object metadata: %w: %w", err, model.ErrDBMalfunctioning)
+			return nil, fmt.Errorf("insert object metadata: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			return nil, nil
+		}
+
+		var old entity.ObjectMeta
+		err = tx.NewSelect().
+			Model(&old).
+			Where("name = ?", e.Name).
+			For("UPDATE").
+			Scan(ctx)
+
+		// The object was deleted in between, so it is inserted again.
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("select object metadata: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+
+		if _, err := tx.NewUpdate().
+			Model(e).
+			Column("size", "checksum", "layout", "fragments").
+			WherePK().
+			Exec(ctx); err != nil {
+			return nil, fmt.Errorf("update object metadata: %w: %w", err, model.ErrDBMalfunctioning)
 		}
 
-		for _, f := range meta.Fragments {
-			_, err := tx.NewUpdate().
-				Model((*entity.Server)(nil)).
-				Set("used_space = used_space + ?", f.FragmentSize).
-				Where("id = ?", f.ServerID).
-				Exec(ctx)
+		replaced, err := old.ToModel()
+		if err != nil {
+			return nil, fmt.Errorf("convert object meta to model: %w", err)
+		}
 
-			if err != nil {
-				return fmt.Errorf("update server used space: %w: %w", err, model.ErrDBMalfunctioning)
+		return &replaced, nil
+	}
+}
+
+// releaseFragments releases the space of the fragments of the replaced or deleted version and queues them
+// for deletion, except those the new version still has.
+func releaseFragments(
+	ctx context.Context, tx bun.Tx, replaced model.ObjectMeta, kept []model.ObjectFragmentMeta,
+) error {
+	deletions := make([]entity.FragmentDeletion, 0, len(replaced.Fragments))
+	for _, f := range replaced.Fragments {
+		if slices.ContainsFunc(kept, func(k model.ObjectFragmentMeta) bool {
+			return k.ServerID == f.ServerID && k.FragmentID == f.FragmentID
+		}) {
+			continue
+		}
+
+		// Sizes of copies of objects stored before sizes were recorded are unknown here,
+		// so their space is released by the FragmentDeleter.
+		if !replaced.SizeUnknown {
+			if err := releaseServerSpace(ctx, tx, f.ServerID, f.FragmentSize); err != nil {
+				return err
 			}
 		}
 
+		deletions = append(deletions, entity.FragmentDeletionFromModel(model.FragmentDeletion{
+			ObjectName:  replaced.ObjectName,
+			ServerID:    f.ServerID,
+			FragmentID:  f.FragmentID,
+			SizeUnknown: replaced.SizeUnknown,
+		}))
+	}
+
+	if len(deletions) == 0 {
 		return nil
-	}); err != nil {
-		return fmt.Errorf("run transaction: %w", err)
+	}
+
+	if _, err := tx.NewInsert().
+		Model(&deletions).
+		Column("object_name", "server_id", "fragment_id", "size_unknown").
+		Exec(ctx); err != nil {
+		return fmt.Errorf("queue fragment deletions: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return nil
+}
+
+// releaseServerSpace subtracts the size of a fragment copy leaving the server from its used space.
+func releaseServerSpace(ctx context.Context, tx bun.IDB, serverID uuid.UUID, size int64) error {
+	_, err := tx.NewUpdate().
+		Model((*entity.Server)(nil)).
+		Set("used_space = GREATEST(used_space - ?, 0)", size).
+		Where("id = ?", serverID).
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("update server used space: %w: %w", err, model.ErrDBMalfunctioning)
 	}
 
 	return nil
@@ -118,6 +237,36 @@ func (db *DB) GetObjectMeta(ctx context.Context, objectName string) (model.Objec
 	return meta, nil
 }
 
+// DeleteObjectMeta removes object metadata, releases the space of its fragments and queues them for deletion.
+func (db *DB) DeleteObjectMeta(ctx context.Context, objectName string) error {
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var e entity.ObjectMeta
+		err := tx.NewDelete().
+			Model(&e).
+			Where("name = ?", objectName).
+			Returning("*").
+			Scan(ctx)
+
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrObjectNotFound
+			}
+			return fmt.Errorf("delete object metadata: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+
+		meta, err := e.ToModel()
+		if err != nil {
+			return fmt.Errorf("convert object meta to model: %w", err)
+		}
+
+		return releaseFragments(ctx, tx, meta, nil)
+	}); err != nil {
+		return fmt.Errorf("run transaction: %w", err)
+	}
+
+	return nil
+}
+
 func (db *DB) GetServers(ctx context.Context) ([]model.Server, error) {
 	var entities []entity.Server
 
@@ -141,3 +290,418 @@ func (db *DB) GetServers(ctx context.Context) ([]model.Server, error) {
 
 	return servers, nil
 }
+
+// UpsertServer registers the server. A server registering with a known ID gets its address and description
+// updated; otherwise the one registered with the same address is updated, keeping its ID, so servers that
+// registered before they kept their IDs get theirs back. A new server is created with server.ID, if set.
+// It fails with model.ErrServerAddrTaken if another server is registered with the address.
+func (db *DB) UpsertServer(ctx context.Context, server model.Server) (model.Server, error) {
+	e := entity.ServerFromModel(server)
+	e.LastHeartbeatAt = time.Now()
+	e.Stale = false
+
+	if server.ID != uuid.Nil {
+		err := db.NewUpdate().
+			Model(&e).
+			Set("addr = ?addr").
+			Set("capacity = ?capacity").
+			Set("labels = ?labels").
+			Set("last_heartbeat_at = ?last_heartbeat_at").
+			Set("stale = ?stale").
+			Set("static = ?static").
+			Set("first_heartbeat_at = COALESCE(first_heartbeat_at, ?last_heartbeat_at)").
+			Set("updated_at = NOW()").
+			WherePK().
+			Returning("*").
+			Scan(ctx)
+
+		switch {
+		case err == nil:
+			return e.ToModel(), nil
+		case isUniqueViolation(err):
+			return model.Server{}, fmt.Errorf("update server '%s': %w", server.ID, model.ErrServerAddrTaken)
+		case !errors.Is(err, sql.ErrNoRows):
+			return model.Server{}, fmt.Errorf("update server: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+	}
+
+	e.FirstHeartbeatAt = e.LastHeartbeatAt
+	columns := []string{"addr", "capacity", "labels", "last_heartbeat_at", "first_heartbeat_at", "stale", "static"}
+	if server.ID != uuid.Nil {
+		columns = append(columns, "id")
+	}
+
+	err := db.NewInsert().
+		Model(&e).
+		Column(columns...).
+		On("CONFLICT (addr) DO UPDATE").
+		Set("capacity = EXCLUDED.capacity").
+		Set("labels = EXCLUDED.labels").
+		Set("last_heartbeat_at = EXCLUDED.last_heartbeat_at").
+		Set("stale = EXCLUDED.stale").
+		Set("static = EXCLUDED.static").
+		Set("first_heartbeat_at = COALESCE(server.first_heartbeat_at, EXCLUDED.first_heartbeat_at)").
+		Set("updated_at = NOW()").
+		Returning("*").
+		Scan(ctx)
+
+	if err != nil {
+		return model.Server{}, fmt.Errorf("upsert server: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return e.ToModel(), nil
+}
+
+// isUniqueViolation reports whether the statement failed on a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pgErr pgdriver.Error
+	return errors.As(err, &pgErr) && pgErr.Field('C') == "23505"
+}
+
+// TouchServer records a heartbeat of the server.
+func (db *DB) TouchServer(ctx context.Context, serverID uuid.UUID, capacity int64) error {
+	res, err := db.NewUpdate().
+		Model((*entity.Server)(nil)).
+		Set("capacity = ?", capacity).
+		Set("last_heartbeat_at = NOW()").
+		Set("first_heartbeat_at = COALESCE(first_heartbeat_at, NOW())").
+		Set("stale = FALSE").
+		Where("id = ?", serverID).
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("update server heartbeat: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return model.ErrServerNotFound
+	}
+
+	return nil
+}
+
+// MarkStaleServers marks servers without a heartbeat since the given time as stale and returns them.
+func (db *DB) MarkStaleServers(ctx context.Context, heartbeatBefore time.Time) ([]model.Server, error) {
+	var entities []entity.Server
+
+	err := db.NewUpdate().
+		Model((*entity.Server)(nil)).
+		Set("stale = TRUE").
+		Where("NOT stale").
+		Where("NOT static").
+		Where("COALESCE(last_heartbeat_at, updated_at) < ?", heartbeatBefore).
+		Returning("*").
+		Scan(ctx, &entities)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("mark stale servers: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	servers := make([]model.Server, 0, len(entities))
+	for _, e := range entities {
+		servers = append(servers, e.ToModel())
+	}
+
+	return servers, nil
+}
+
+// SetServerStatus changes the scheduling status of the server.
+func (db *DB) SetServerStatus(ctx context.Context, serverID uuid.UUID, status model.ServerStatus) error {
+	res, err := db.NewUpdate().
+		Model((*entity.Server)(nil)).
+		Set("status = ?", status).
+		Set("updated_at = NOW()").
+		Where("id = ?", serverID).
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("update server status: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return model.ErrServerNotFound
+	}
+
+	return nil
+}
+
+// DeleteServer removes the server from the cluster. It fails with model.ErrServerNotEmpty
+// while any object still has fragments on the server.
+func (db *DB) DeleteServer(ctx context.Context, serverID uuid.UUID) error {
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Saving an object updates the used space of its servers, so with the server row locked
+		// a concurrent save either is seen by the check below or fails once the server is gone.
+		var e entity.Server
+		err := tx.NewSelect().
+			Model(&e).
+			Where("id = ?", serverID).
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrServerNotFound
+			}
+			return fmt.Errorf("select server: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+
+		referenced, err := tx.NewSelect().
+			TableExpr("objects_metadata AS o, jsonb_array_elements(o.fragments) AS f").
+			Where("f->>'server_id' = ?", serverID.String()).
+			Exists(ctx)
+		if err != nil {
+			return fmt.Errorf("check server fragments: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+		if referenced {
+			return model.ErrServerNotEmpty
+		}
+
+		if _, err := tx.NewDelete().
+			Model((*entity.Server)(nil)).
+			Where("id = ?", serverID).
+			Exec(ctx); err != nil {
+			return fmt.Errorf("delete server: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("delete server: %w", err)
+	}
+
+	return nil
+}
+
+// GetFragmentCounts returns the number of fragments every server holds. Servers without fragments are left out.
+func (db *DB) GetFragmentCounts(ctx context.Context) (map[uuid.UUID]int64, error) {
+	var rows []struct {
+		ServerID uuid.UUID `bun:"server_id"`
+		Count    int64     `bun:"count"`
+	}
+
+	err := db.NewSelect().
+		TableExpr("objects_metadata AS o, jsonb_array_elements(o.fragments) AS f").
+		ColumnExpr("(f->>'server_id')::uuid AS server_id").
+		ColumnExpr("COUNT(*) AS count").
+		GroupExpr("1").
+		Scan(ctx, &rows)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("count server fragments: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	counts := make(map[uuid.UUID]int64, len(rows))
+	for _, r := range rows {
+		counts[r.ServerID] = r.Count
+	}
+
+	return counts, nil
+}
+
+// GetObjectStats returns the number of stored objects and their total size.
+func (db *DB) GetObjectStats(ctx context.Context) (model.ObjectStats, error) {
+	var stats model.ObjectStats
+
+	// Objects stored before the size column was added have it zeroed, see entity.ObjectMeta.ToModel.
+	err := db.NewSelect().
+		Model((*entity.ObjectMeta)(nil)).
+		ColumnExpr("COUNT(*)").
+		ColumnExpr(`COALESCE(SUM(CASE WHEN size > 0 THEN size ELSE (
+			SELECT SUM((f->>'fragment_size')::bigint)
+			FROM jsonb_array_elements(fragments) AS f
+			WHERE COALESCE((f->>'replica')::int, 0) = 0
+		) END), 0)`).
+		Scan(ctx, &stats.Count, &stats.Bytes)
+
+	if err != nil {
+		return model.ObjectStats{}, fmt.Errorf("select object stats: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return stats, nil
+}
+
+// ListObjectMeta returns up to limit objects with names after the given one, ordered by name.
+func (db *DB) ListObjectMeta(ctx context.Context, after string, limit int) ([]model.ObjectMeta, error) {
+	var entities []entity.ObjectMeta
+
+	err := db.NewSelect().
+		Model(&entities).
+		Where("name > ?", after).
+		Order("name").
+		Limit(limit).
+		Scan(ctx)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("select objects metadata: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	metas := make([]model.ObjectMeta, 0, len(entities))
+	for _, e := range entities {
+		meta, err := e.ToModel()
+		if err != nil {
+			return nil, fmt.Errorf("convert object meta to model: %w", err)
+		}
+		metas = append(metas, meta)
+	}
+
+	return metas, nil
+}
+
+// GetServerFragmentStats returns the number and total size of fragments objects reference on the server.
+func (db *DB) GetServerFragmentStats(ctx context.Context, serverID uuid.UUID) (model.FragmentStats, error) {
+	var stats model.FragmentStats
+
+	err := db.NewSelect().
+		TableExpr("objects_metadata AS o, jsonb_array_elements(o.fragments) AS f").
+		ColumnExpr("COUNT(*)").
+		ColumnExpr("COALESCE(SUM((f->>'fragment_size')::bigint), 0)").
+		Where("f->>'server_id' = ?", serverID.String()).
+		Scan(ctx, &stats.Count, &stats.Bytes)
+
+	if err != nil {
+		return model.FragmentStats{}, fmt.Errorf("select server fragment stats: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return stats, nil
+}
+
+// ListReferencedFragments returns the IDs of fragments on the server that objects or pending uploads reference,
+// that fragment moves copy from or to it, or that are queued for deletion.
+func (db *DB) ListReferencedFragments(ctx context.Context, serverID uuid.UUID) ([]uuid.UUID, error) {
+	var fragmentIDs []uuid.UUID
+
+	err := db.NewSelect().
+		TableExpr("objects_metadata AS o, jsonb_array_elements(o.fragments) AS f").
+		ColumnExpr("(f->>'fragment_id')::uuid").
+		Where("f->>'server_id' = ?", serverID.String()).
+		Union(
+			db.NewSelect().
+				Model((*entity.FragmentMove)(nil)).
+				Column("fragment_id").
+				Where("? IN (source_server_id, target_server_id)", serverID),
+		).
+		Union(
+			db.NewSelect().
+				TableExpr("pending_uploads AS u, jsonb_array_elements(u.fragments) AS f").
+				ColumnExpr("(f->>'fragment_id')::uuid").
+				Where("f->>'server_id' = ?", serverID.String()),
+		).
+		Union(
+			db.NewSelect().
+				Model((*entity.FragmentDeletion)(nil)).
+				Column("fragment_id").
+				Where("server_id = ?", serverID),
+		).
+		Scan(ctx, &fragmentIDs)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("select referenced fragments: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return fragmentIDs, nil
+}
+
+// IsFragmentReferencedAnywhere reports whether objects, pending uploads, fragment moves or queued deletions
+// reference the fragment, on any server.
+func (db *DB) IsFragmentReferencedAnywhere(ctx context.Context, fragmentID uuid.UUID) (bool, error) {
+	contains := fmt.Sprintf(`[{"fragment_id": %q}]`, fragmentID)
+
+	var referenced bool
+	err := db.NewSelect().
+		ColumnExpr("EXISTS (?) OR EXISTS (?) OR EXISTS (?) OR EXISTS (?)",
+			db.NewSelect().Model((*entity.ObjectMeta)(nil)).ColumnExpr("1").Where("fragments @> ?", contains),
+			db.NewSelect().Model((*entity.PendingUpload)(nil)).ColumnExpr("1").Where("fragments @> ?", contains),
+			db.NewSelect().Model((*entity.FragmentMove)(nil)).ColumnExpr("1").Where("fragment_id = ?", fragmentID),
+			db.NewSelect().Model((*entity.FragmentDeletion)(nil)).ColumnExpr("1").Where("fragment_id = ?", fragmentID),
+		).
+		Scan(ctx, &referenced)
+
+	if err != nil {
+		return false, fmt.Errorf("check fragment references: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return referenced, nil
+}
+
+// ListUnsizedObjects returns up to limit objects stored before sizes were recorded,
+// with names after the given one, ordered by name.
+func (db *DB) ListUnsizedObjects(ctx context.Context, after string, limit int) ([]model.ObjectMeta, error) {
+	var entities []entity.ObjectMeta
+
+	err := db.NewSelect().
+		Model(&entities).
+		Where("size = 0 AND checksum = ''").
+		Where(`NOT EXISTS (
+			SELECT 1 FROM jsonb_array_elements(fragments) AS f WHERE (f->>'fragment_size')::bigint > 0
+		)`).
+		Where("name > ?", after).
+		Order("name").
+		Limit(limit).
+		Scan(ctx)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("select unsized objects: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	metas := make([]model.ObjectMeta, 0, len(entities))
+	for _, e := range entities {
+		meta, err := e.ToModel()
+		if err != nil {
+			return nil, fmt.Errorf("convert object meta to model: %w", err)
+		}
+		metas = append(metas, meta)
+	}
+
+	return metas, nil
+}
+
+// SetObjectSizes records the size of an object stored before sizes were, and those of its fragments.
+// Their space was accounted to the servers when the object was stored, so it is left as is.
+// It fails with model.ErrFragmentChanged if the fragments of the object changed since it was read.
+func (db *DB) SetObjectSizes(ctx context.Context, meta model.ObjectMeta) error {
+	e, err := entity.ObjectMetaFromModel(meta)
+	if err != nil {
+		return fmt.Errorf("convert object meta to db entity: %w", err)
+	}
+
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var current entity.ObjectMeta
+		err := tx.NewSelect().
+			Model(&current).
+			Where("name = ?", meta.ObjectName).
+			For("UPDATE").
+			Scan(ctx)
+
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrObjectNotFound
+			}
+			return fmt.Errorf("select object metadata: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+
+		currentMeta, err := current.ToModel()
+		if err != nil {
+			return fmt.Errorf("convert object meta to model: %w", err)
+		}
+		if !currentMeta.SizeUnknown || !slices.EqualFunc(currentMeta.Fragments, meta.Fragments, sameCopy) {
+			return model.ErrFragmentChanged
+		}
+
+		if _, err := tx.NewUpdate().
+			Model(&e).
+			Column("size", "fragments").
+			WherePK().
+			Exec(ctx); err != nil {
+			return fmt.Errorf("update object sizes: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("run transaction: %w", err)
+	}
+
+	return nil
+}
+
+// sameCopy reports whether both describe the same copy of the same fragment.
+func sameCopy(a, b model.ObjectFragmentMeta) bool {
+	return a.SeqNum == b.SeqNum && a.Replica == b.Replica && a.ServerID == b.ServerID && a.FragmentID == b.FragmentID
+}
@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+type FragmentDeletion struct {
+	bun.BaseModel `bun:"table:fragment_deletions"`
+
+	ID          uuid.UUID `bun:"id,pk,nullzero"`
+	ObjectName  string    `bun:"object_name"`
+	ServerID    uuid.UUID `bun:"server_id"`
+	FragmentID  uuid.UUID `bun:"fragment_id"`
+	SizeUnknown bool      `bun:"size_unknown"`
+	CreatedAt   time.Time `bun:"created_at,nullzero"`
+}
+
+func (m FragmentDeletion) ToModel() model.FragmentDeletion {
+	return model.FragmentDeletion{
+		ID:          m.ID,
+		ObjectName:  m.ObjectName,
+		ServerID:    m.ServerID,
+		FragmentID:  m.FragmentID,
+		SizeUnknown: m.SizeUnknown,
+		CreatedAt:   m.CreatedAt,
+	}
+}
+
+func FragmentDeletionFromModel(m model.FragmentDeletion) FragmentDeletion {
+	return FragmentDeletion{
+		ID:          m.ID,
+		ObjectName:  m.ObjectName,
+		ServerID:    m.ServerID,
+		FragmentID:  m.FragmentID,
+		SizeUnknown: m.SizeUnknown,
+		CreatedAt:   m.CreatedAt,
+	}
+}
@@ -0,0 +1,67 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+type FragmentMove struct {
+	bun.BaseModel `bun:"table:fragment_moves"`
+
+	ID             uuid.UUID `bun:"id,pk,nullzero"`
+	ObjectName     string    `bun:"object_name"`
+	SeqNum         int       `bun:"seq_num"`
+	FragmentID     uuid.UUID `bun:"fragment_id"`
+	FragmentSize   int64     `bun:"fragment_size"`
+	Checksum       string    `bun:"checksum"`
+	SourceServerID uuid.UUID `bun:"source_server_id"`
+	TargetServerID uuid.UUID `bun:"target_server_id"`
+	Reason         string    `bun:"reason"`
+	State          string    `bun:"state,nullzero"`
+	Attempts       int       `bun:"attempts"`
+	LastError      string    `bun:"last_error"`
+	CreatedAt      time.Time `bun:"created_at,nullzero"`
+	UpdatedAt      time.Time `bun:"updated_at,nullzero"`
+}
+
+func (m FragmentMove) ToModel() model.FragmentMove {
+	return model.FragmentMove{
+		ID:             m.ID,
+		ObjectName:     m.ObjectName,
+		SeqNum:         m.SeqNum,
+		FragmentID:     m.FragmentID,
+		FragmentSize:   m.FragmentSize,
+		Checksum:       m.Checksum,
+		SourceServerID: m.SourceServerID,
+		TargetServerID: m.TargetServerID,
+		Reason:         model.MoveReason(m.Reason),
+		State:          model.MoveState(m.State),
+		Attempts:       m.Attempts,
+		LastError:      m.LastError,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+}
+
+func FragmentMoveFromModel(m model.FragmentMove) FragmentMove {
+	return FragmentMove{
+		ID:             m.ID,
+		ObjectName:     m.ObjectName,
+		SeqNum:         m.SeqNum,
+		FragmentID:     m.FragmentID,
+		FragmentSize:   m.FragmentSize,
+		Checksum:       m.Checksum,
+		SourceServerID: m.SourceServerID,
+		TargetServerID: m.TargetServerID,
+		Reason:         string(m.Reason),
+		State:          string(m.State),
+		Attempts:       m.Attempts,
+		LastError:      m.LastError,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+}
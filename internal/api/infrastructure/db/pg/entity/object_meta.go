@@ -14,54 +14,127 @@ type ObjectMeta struct {
 	bun.BaseModel `bun:"table:objects_metadata"`
 
 	Name      string          `bun:"name,pk"`
+	Size      int64           `bun:"size"`
+	Checksum  string          `bun:"checksum"`
+	Layout    objectLayout    `bun:"layout,type:jsonb"`
 	Fragments json.RawMessage `bun:"fragments"`
 }
 
+type objectLayout struct {
+	Scheme       string `json:"scheme,omitempty"`
+	Replicas     int    `json:"replicas,omitempty"`
+	DataShards   int    `json:"data_shards,omitempty"`
+	ParityShards int    `json:"parity_shards,omitempty"`
+}
+
 type objectMetaFragment struct {
-	SeqNum     int       `json:"seq_num"`
-	ServerID   uuid.UUID `json:"server_id"`
-	FragmentID uuid.UUID `json:"fragment_id"`
+	SeqNum       int       `json:"seq_num"`
+	Replica      int       `json:"replica,omitempty"`
+	ServerID     uuid.UUID `json:"server_id"`
+	FragmentID   uuid.UUID `json:"fragment_id"`
+	FragmentSize int64     `json:"fragment_size"`
+	Checksum     string    `json:"checksum,omitempty"`
 }
 
 func (m ObjectMeta) ToModel() (model.ObjectMeta, error) {
-	var fragments []objectMetaFragment
-	err := json.Unmarshal(m.Fragments, &fragments)
+	modelFragments, err := unmarshalFragments(m.Fragments)
+	if err != nil {
+		return model.ObjectMeta{}, err
+	}
+
+	// Objects stored before the size column was added have it zeroed. They are all replicated,
+	// so the size is the sum of their fragments, unless they were stored before fragment sizes were recorded too.
+	// Objects stored since always have a checksum, even empty ones.
+	size := m.Size
+	sizeUnknown := false
+	if size == 0 && m.Checksum == "" {
+		for _, f := range modelFragments {
+			if f.Replica == 0 {
+				size += f.FragmentSize
+			}
+		}
+		sizeUnknown = size == 0 && len(modelFragments) > 0
+	}
+
+	layout := model.Layout{
+		Scheme:       model.LayoutScheme(m.Layout.Scheme),
+		Replicas:     m.Layout.Replicas,
+		DataShards:   m.Layout.DataShards,
+		ParityShards: m.Layout.ParityShards,
+	}
+	// Objects stored before layouts were recorded are replicated ones.
+	if layout.Scheme == "" {
+		layout.Scheme = model.LayoutReplicated
+	}
+
+	return model.ObjectMeta{
+		ObjectName:  m.Name,
+		Size:        size,
+		Layout:      layout,
+		Checksum:    m.Checksum,
+		Fragments:   modelFragments,
+		SizeUnknown: sizeUnknown,
+	}, nil
+}
+
+func ObjectMetaFromModel(m model.ObjectMeta) (ObjectMeta, error) {
+	fragmentsData, err := marshalFragments(m.Fragments)
 	if err != nil {
-		return model.ObjectMeta{}, fmt.Errorf("unmarshal fragments: %w", err)
+		return ObjectMeta{}, err
+	}
+
+	return ObjectMeta{
+		Name:     m.ObjectName,
+		Size:     m.Size,
+		Checksum: m.Checksum,
+		Layout: objectLayout{
+			Scheme:       string(m.Layout.Scheme),
+			Replicas:     m.Layout.Replicas,
+			DataShards:   m.Layout.DataShards,
+			ParityShards: m.Layout.ParityShards,
+		},
+		Fragments: fragmentsData,
+	}, nil
+}
+
+func unmarshalFragments(data json.RawMessage) ([]model.ObjectFragmentMeta, error) {
+	var fragments []objectMetaFragment
+	if err := json.Unmarshal(data, &fragments); err != nil {
+		return nil, fmt.Errorf("unmarshal fragments: %w", err)
 	}
 
 	modelFragments := make([]model.ObjectFragmentMeta, 0, len(fragments))
 	for _, f := range fragments {
 		modelFragments = append(modelFragments, model.ObjectFragmentMeta{
-			SeqNum:     f.SeqNum,
-			ServerID:   f.ServerID,
-			FragmentID: f.FragmentID,
+			SeqNum:       f.SeqNum,
+			Replica:      f.Replica,
+			ServerID:     f.ServerID,
+			FragmentID:   f.FragmentID,
+			FragmentSize: f.FragmentSize,
+			Checksum:     f.Checksum,
 		})
 	}
 
-	return model.ObjectMeta{
-		ObjectName: m.Name,
-		Fragments:  modelFragments,
-	}, nil
+	return modelFragments, nil
 }
 
-func ObjectMetaFromModel(m model.ObjectMeta) (ObjectMeta, error) {
-	fragments := make([]objectMetaFragment, 0, len(m.Fragments))
-	for _, f := range m.Fragments {
-		fragments = append(fragments, objectMetaFragment{
-			SeqNum:     f.SeqNum,
-			ServerID:   f.ServerID,
-			FragmentID: f.FragmentID,
+func marshalFragments(fragments []model.ObjectFragmentMeta) (json.RawMessage, error) {
+	entities := make([]objectMetaFragment, 0, len(fragments))
+	for _, f := range fragments {
+		entities = append(entities, objectMetaFragment{
+			SeqNum:       f.SeqNum,
+			Replica:      f.Replica,
+			ServerID:     f.ServerID,
+			FragmentID:   f.FragmentID,
+			FragmentSize: f.FragmentSize,
+			Checksum:     f.Checksum,
 		})
 	}
 
-	fragmentsData, err := json.Marshal(fragments)
+	data, err := json.Marshal(entities)
 	if err != nil {
-		return ObjectMeta{}, fmt.Errorf("marshal fragments: %w", err)
+		return nil, fmt.Errorf("marshal fragments: %w", err)
 	}
 
-	return ObjectMeta{
-		Name:      m.ObjectName,
-		Fragments: fragmentsData,
-	}, nil
+	return data, nil
 }
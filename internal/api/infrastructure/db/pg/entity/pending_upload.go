@@ -0,0 +1,54 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+type PendingUpload struct {
+	bun.BaseModel `bun:"table:pending_uploads"`
+
+	ID         uuid.UUID       `bun:"id,pk,nullzero"`
+	ObjectName string          `bun:"object_name"`
+	Size       int64           `bun:"size"`
+	Fragments  json.RawMessage `bun:"fragments"`
+	CreatedAt  time.Time       `bun:"created_at,nullzero"`
+	UpdatedAt  time.Time       `bun:"updated_at,nullzero"`
+}
+
+func (m PendingUpload) ToModel() (model.PendingUpload, error) {
+	fragments, err := unmarshalFragments(m.Fragments)
+	if err != nil {
+		return model.PendingUpload{}, err
+	}
+
+	return model.PendingUpload{
+		ID:         m.ID,
+		ObjectName: m.ObjectName,
+		Size:       m.Size,
+		Fragments:  fragments,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}, nil
+}
+
+func PendingUploadFromModel(m model.PendingUpload) (PendingUpload, error) {
+	fragments, err := marshalFragments(m.Fragments)
+	if err != nil {
+		return PendingUpload{}, err
+	}
+
+	return PendingUpload{
+		ID:         m.ID,
+		ObjectName: m.ObjectName,
+		Size:       m.Size,
+		Fragments:  fragments,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}, nil
+}
@@ -0,0 +1,48 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+type Repair struct {
+	bun.BaseModel `bun:"table:repairs"`
+
+	ObjectName string    `bun:"object_name,pk"`
+	Missing    int       `bun:"missing"`
+	Repaired   int       `bun:"repaired"`
+	State      string    `bun:"state,nullzero"`
+	Attempts   int       `bun:"attempts"`
+	LastError  string    `bun:"last_error"`
+	CreatedAt  time.Time `bun:"created_at,nullzero"`
+	UpdatedAt  time.Time `bun:"updated_at,nullzero"`
+}
+
+func (m Repair) ToModel() model.Repair {
+	return model.Repair{
+		ObjectName: m.ObjectName,
+		Missing:    m.Missing,
+		Repaired:   m.Repaired,
+		State:      model.RepairState(m.State),
+		Attempts:   m.Attempts,
+		LastError:  m.LastError,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}
+}
+
+func RepairFromModel(m model.Repair) Repair {
+	return Repair{
+		ObjectName: m.ObjectName,
+		Missing:    m.Missing,
+		Repaired:   m.Repaired,
+		State:      string(m.State),
+		Attempts:   m.Attempts,
+		LastError:  m.LastError,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}
+}
@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
 
@@ -10,23 +12,44 @@ import (
 type Server struct {
 	bun.BaseModel `bun:"table:servers"`
 
-	ID        uuid.UUID `bun:"id,pk,nullzero"`
-	Addr      string    `bun:"addr"`
-	UsedSpace int64     `bun:"used_space"`
+	ID               uuid.UUID         `bun:"id,pk,nullzero"`
+	Addr             string            `bun:"addr"`
+	Status           string            `bun:"status,nullzero"`
+	UsedSpace        int64             `bun:"used_space"`
+	Capacity         int64             `bun:"capacity"`
+	Labels           map[string]string `bun:"labels,type:jsonb,nullzero"`
+	LastHeartbeatAt  time.Time         `bun:"last_heartbeat_at,nullzero"`
+	FirstHeartbeatAt time.Time         `bun:"first_heartbeat_at,nullzero"`
+	Stale            bool              `bun:"stale"`
+	Static           bool              `bun:"static"`
 }
 
 func (s Server) ToModel() model.Server {
 	return model.Server{
-		ID:        s.ID,
-		Addr:      s.Addr,
-		UsedSpace: s.UsedSpace,
+		ID:               s.ID,
+		Addr:             s.Addr,
+		Status:           model.ServerStatus(s.Status),
+		UsedSpace:        s.UsedSpace,
+		Capacity:         s.Capacity,
+		Labels:           s.Labels,
+		LastHeartbeatAt:  s.LastHeartbeatAt,
+		FirstHeartbeatAt: s.FirstHeartbeatAt,
+		Stale:            s.Stale,
+		Static:           s.Static,
 	}
 }
 
 func ServerFromModel(m model.Server) Server {
 	return Server{
-		ID:        m.ID,
-		Addr:      m.Addr,
-		UsedSpace: m.UsedSpace,
+		ID:               m.ID,
+		Addr:             m.Addr,
+		Status:           string(m.Status),
+		UsedSpace:        m.UsedSpace,
+		Capacity:         m.Capacity,
+		Labels:           m.Labels,
+		LastHeartbeatAt:  m.LastHeartbeatAt,
+		FirstHeartbeatAt: m.FirstHeartbeatAt,
+		Stale:            m.Stale,
+		Static:           m.Static,
 	}
 }
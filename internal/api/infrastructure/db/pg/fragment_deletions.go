@@ -0,0 +1,80 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/ssimpl/simple-storage/internal/api/infrastructure/db/pg/entity"
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+// ListFragmentDeletions returns up to limit fragment deletions queued before the given time, oldest first.
+func (db *DB) ListFragmentDeletions(
+	ctx context.Context, createdBefore time.Time, limit int,
+) ([]model.FragmentDeletion, error) {
+	var entities []entity.FragmentDeletion
+
+	err := db.NewSelect().
+		Model(&entities).
+		Where("created_at < ?", createdBefore).
+		Order("created_at").
+		Limit(limit).
+		Scan(ctx)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("select fragment deletions: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	deletions := make([]model.FragmentDeletion, 0, len(entities))
+	for _, e := range entities {
+		deletions = append(deletions, e.ToModel())
+	}
+
+	return deletions, nil
+}
+
+// ReleaseFragmentDeletionSpace subtracts the size of the queued copy, reported by the server holding it,
+// from the used space of the server, unless it was released before.
+func (db *DB) ReleaseFragmentDeletionSpace(ctx context.Context, deletion model.FragmentDeletion, size int64) error {
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewUpdate().
+			Model((*entity.FragmentDeletion)(nil)).
+			Set("size_unknown = FALSE").
+			Where("id = ?", deletion.ID).
+			Where("size_unknown").
+			Exec(ctx)
+
+		if err != nil {
+			return fmt.Errorf("update fragment deletion: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return nil
+		}
+
+		return releaseServerSpace(ctx, tx, deletion.ServerID, size)
+	}); err != nil {
+		return fmt.Errorf("run transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFragmentDeletion removes the deletion from the queue once the fragment is deleted.
+func (db *DB) DeleteFragmentDeletion(ctx context.Context, deletionID uuid.UUID) error {
+	_, err := db.NewDelete().
+		Model((*entity.FragmentDeletion)(nil)).
+		Where("id = ?", deletionID).
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("delete fragment deletion: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return nil
+}
@@ -0,0 +1,268 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/ssimpl/simple-storage/internal/api/infrastructure/db/pg/entity"
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+// CreateFragmentMoves queues the moves. Moves of fragment copies already being moved are skipped.
+func (db *DB) CreateFragmentMoves(ctx context.Context, moves []model.FragmentMove) error {
+	if len(moves) == 0 {
+		return nil
+	}
+
+	entities := make([]entity.FragmentMove, 0, len(moves))
+	for _, m := range moves {
+		entities = append(entities, entity.FragmentMoveFromModel(m))
+	}
+
+	_, err := db.NewInsert().
+		Model(&entities).
+		ExcludeColumn("id", "state", "created_at", "updated_at").
+		On("CONFLICT (fragment_id, source_server_id) WHERE state <> ? DO NOTHING", model.MoveFailed).
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("insert fragment moves: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return nil
+}
+
+// GetFragmentMoves returns all queued, switched and failed moves, oldest first.
+func (db *DB) GetFragmentMoves(ctx context.Context) ([]model.FragmentMove, error) {
+	var entities []entity.FragmentMove
+
+	err := db.NewSelect().
+		Model(&entities).
+		Order("created_at", "id").
+		Scan(ctx)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("select fragment moves: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	moves := make([]model.FragmentMove, 0, len(entities))
+	for _, e := range entities {
+		moves = append(moves, e.ToModel())
+	}
+
+	return moves, nil
+}
+
+// UpdateFragmentMove saves the state, attempts and last error of the move.
+func (db *DB) UpdateFragmentMove(ctx context.Context, move model.FragmentMove) error {
+	_, err := db.NewUpdate().
+		Model((*entity.FragmentMove)(nil)).
+		Set("state = ?", move.State).
+		Set("attempts = ?", move.Attempts).
+		Set("last_error = ?", move.LastError).
+		Set("updated_at = NOW()").
+		Where("id = ?", move.ID).
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("update fragment move: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return nil
+}
+
+func (db *DB) DeleteFragmentMove(ctx context.Context, moveID uuid.UUID) error {
+	_, err := db.NewDelete().
+		Model((*entity.FragmentMove)(nil)).
+		Where("id = ?", moveID).
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("delete fragment move: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return nil
+}
+
+// SwitchFragmentServer points the moved fragment copy of the object at the target server, moves its size
+// between the used space of the servers and marks the move switched, all at once. It fails with
+// model.ErrFragmentChanged if the object no longer has the fragment copy on the source server.
+func (db *DB) SwitchFragmentServer(ctx context.Context, move model.FragmentMove) error {
+	fragment := model.ObjectFragmentMeta{
+		SeqNum:       move.SeqNum,
+		ServerID:     move.SourceServerID,
+		FragmentID:   move.FragmentID,
+		FragmentSize: move.FragmentSize,
+	}
+
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := setFragmentServer(ctx, tx, move.ObjectName, fragment, move.TargetServerID); err != nil {
+			return err
+		}
+
+		if _, err := tx.NewUpdate().
+			Model((*entity.FragmentMove)(nil)).
+			Set("state = ?", model.MoveSwitched).
+			Set("last_error = ''").
+			Set("updated_at = NOW()").
+			Where("id = ?", move.ID).
+			Exec(ctx); err != nil {
+			return fmt.Errorf("update fragment move: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("switch fragment server: %w", err)
+	}
+
+	return nil
+}
+
+// SetFragmentServer points the fragment copy of the object at another server and moves its size
+// between the used space of the servers. It fails with model.ErrFragmentChanged
+// if the object no longer has the fragment copy.
+func (db *DB) SetFragmentServer(
+	ctx context.Context, objectName string, fragment model.ObjectFragmentMeta, serverID uuid.UUID,
+) error {
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return setFragmentServer(ctx, tx, objectName, fragment, serverID)
+	}); err != nil {
+		return fmt.Errorf("set fragment server: %w", err)
+	}
+
+	return nil
+}
+
+// setFragmentServer finds the copy of the fragment with the same sequence number and ID on the same server
+// among the fragments of the object and points it at the given server.
+func setFragmentServer(
+	ctx context.Context, tx bun.Tx, objectName string, fragment model.ObjectFragmentMeta, serverID uuid.UUID,
+) error {
+	var e entity.ObjectMeta
+	err := tx.NewSelect().
+		Model(&e).
+		Where("name = ?", objectName).
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrFragmentChanged
+		}
+		return fmt.Errorf("select object metadata: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	meta, err := e.ToModel()
+	if err != nil {
+		return fmt.Errorf("convert object meta to model: %w", err)
+	}
+
+	i := slices.IndexFunc(meta.Fragments, func(f model.ObjectFragmentMeta) bool {
+		return f.SeqNum == fragment.SeqNum && f.FragmentID == fragment.FragmentID && f.ServerID == fragment.ServerID
+	})
+	if i < 0 {
+		return model.ErrFragmentChanged
+	}
+	meta.Fragments[i].ServerID = serverID
+
+	updated, err := entity.ObjectMetaFromModel(meta)
+	if err != nil {
+		return fmt.Errorf("convert object meta to db entity: %w", err)
+	}
+
+	if _, err := tx.NewUpdate().
+		Model(&updated).
+		Column("fragments").
+		WherePK().
+		Exec(ctx); err != nil {
+		return fmt.Errorf("update object fragments: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	for id, delta := range map[uuid.UUID]int64{
+		fragment.ServerID: -fragment.FragmentSize,
+		serverID:          fragment.FragmentSize,
+	} {
+		res, err := tx.NewUpdate().
+			Model((*entity.Server)(nil)).
+			Set("used_space = GREATEST(used_space + ?, 0)", delta).
+			Where("id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("update server used space: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+		// The previous server may be gone, the new one must not.
+		if n, err := res.RowsAffected(); err == nil && n == 0 && id == serverID {
+			return model.ErrServerNotFound
+		}
+	}
+
+	return nil
+}
+
+// IsFragmentReferenced reports whether any object has the fragment on the server.
+func (db *DB) IsFragmentReferenced(ctx context.Context, serverID, fragmentID uuid.UUID) (bool, error) {
+	referenced, err := db.NewSelect().
+		Model((*entity.ObjectMeta)(nil)).
+		Where("fragments @> ?", fmt.Sprintf(`[{"server_id": %q, "fragment_id": %q}]`, serverID, fragmentID)).
+		Exists(ctx)
+
+	if err != nil {
+		return false, fmt.Errorf("check fragment references: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return referenced, nil
+}
+
+// ListFragmentObjects returns the names of objects having the fragment on the server.
+func (db *DB) ListFragmentObjects(ctx context.Context, serverID, fragmentID uuid.UUID) ([]string, error) {
+	var names []string
+
+	err := db.NewSelect().
+		Model((*entity.ObjectMeta)(nil)).
+		Column("name").
+		Where("fragments @> ?", fmt.Sprintf(`[{"server_id": %q, "fragment_id": %q}]`, serverID, fragmentID)).
+		Order("name").
+		Scan(ctx, &names)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("select fragment objects: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return names, nil
+}
+
+// ListServerObjects returns up to limit objects having fragments on the server, with names after the given one,
+// ordered by name.
+func (db *DB) ListServerObjects(
+	ctx context.Context, serverID uuid.UUID, after string, limit int,
+) ([]model.ObjectMeta, error) {
+	var entities []entity.ObjectMeta
+
+	err := db.NewSelect().
+		Model(&entities).
+		Where("fragments @> ?", fmt.Sprintf(`[{"server_id": %q}]`, serverID)).
+		Where("name > ?", after).
+		Order("name").
+		Limit(limit).
+		Scan(ctx)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("select server objects: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	metas := make([]model.ObjectMeta, 0, len(entities))
+	for _, e := range entities {
+		meta, err := e.ToModel()
+		if err != nil {
+			return nil, fmt.Errorf("convert object meta to model: %w", err)
+		}
+		metas = append(metas, meta)
+	}
+
+	return metas, nil
+}
@@ -0,0 +1,41 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+// TryLock takes the session-level advisory lock with the given key on a connection of its own,
+// so only one API server runs the job it guards. It reports false without waiting if another session holds the lock.
+// The lock is held until release is called or the connection breaks.
+func (db *DB) TryLock(ctx context.Context, key int64) (func(), bool, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("get connection: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	var acquired bool
+	if err := conn.NewRaw("SELECT pg_try_advisory_lock(?)", key).Scan(ctx, &acquired); err != nil {
+		_ = conn.Close()
+		return nil, false, fmt.Errorf("take advisory lock: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	if !acquired {
+		_ = conn.Close()
+		return nil, false, nil
+	}
+
+	release := func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			slog.Error("Failed to release advisory lock", "key", key, "err", err)
+		}
+		if err := conn.Close(); err != nil {
+			slog.Error("Failed to close locked connection", "err", err)
+		}
+	}
+
+	return release, true, nil
+}
@@ -0,0 +1,168 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/ssimpl/simple-storage/internal/api/infrastructure/db/pg/entity"
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+// CreatePendingUpload journals an upload starting and returns it with its ID.
+func (db *DB) CreatePendingUpload(ctx context.Context, upload model.PendingUpload) (model.PendingUpload, error) {
+	e, err := entity.PendingUploadFromModel(upload)
+	if err != nil {
+		return model.PendingUpload{}, fmt.Errorf("convert pending upload to db entity: %w", err)
+	}
+
+	err = db.NewInsert().
+		Model(&e).
+		Column("object_name", "size", "fragments").
+		Returning("*").
+		Scan(ctx)
+
+	if err != nil {
+		return model.PendingUpload{}, fmt.Errorf("insert pending upload: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	created, err := e.ToModel()
+	if err != nil {
+		return model.PendingUpload{}, fmt.Errorf("convert pending upload to model: %w", err)
+	}
+
+	return created, nil
+}
+
+// AddPendingFragments records fragment copies stored for the upload.
+// It fails with model.ErrUploadAbandoned if the upload is no longer pending.
+func (db *DB) AddPendingFragments(
+	ctx context.Context, uploadID uuid.UUID, fragments []model.ObjectFragmentMeta,
+) error {
+	e, err := entity.PendingUploadFromModel(model.PendingUpload{Fragments: fragments})
+	if err != nil {
+		return fmt.Errorf("convert pending upload to db entity: %w", err)
+	}
+
+	res, err := db.NewUpdate().
+		Model((*entity.PendingUpload)(nil)).
+		Set("fragments = fragments || ?::jsonb", string(e.Fragments)).
+		Set("updated_at = NOW()").
+		Where("id = ?", uploadID).
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("update pending upload: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return model.ErrUploadAbandoned
+	}
+
+	return nil
+}
+
+// TouchPendingUpload records that the upload is still running.
+// It fails with model.ErrUploadAbandoned if the upload is no longer pending.
+func (db *DB) TouchPendingUpload(ctx context.Context, uploadID uuid.UUID) error {
+	res, err := db.NewUpdate().
+		Model((*entity.PendingUpload)(nil)).
+		Set("updated_at = NOW()").
+		Where("id = ?", uploadID).
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("update pending upload: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return model.ErrUploadAbandoned
+	}
+
+	return nil
+}
+
+// CommitUpload saves the object metadata and removes the upload from the journal in one transaction.
+// It fails with model.ErrUploadAbandoned if the upload is no longer pending, in which case nothing is saved.
+func (db *DB) CommitUpload(ctx context.Context, uploadID uuid.UUID, meta model.ObjectMeta) error {
+	if err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewDelete().
+			Model((*entity.PendingUpload)(nil)).
+			Where("id = ?", uploadID).
+			Exec(ctx)
+
+		if err != nil {
+			return fmt.Errorf("delete pending upload: %w: %w", err, model.ErrDBMalfunctioning)
+		}
+
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return model.ErrUploadAbandoned
+		}
+
+		return saveObjectMeta(ctx, tx, meta)
+	}); err != nil {
+		return fmt.Errorf("run transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePendingUpload removes the upload from the journal and returns it, so the caller can delete
+// its fragments. It fails with model.ErrUploadAbandoned if the upload is no longer pending.
+func (db *DB) DeletePendingUpload(ctx context.Context, uploadID uuid.UUID) (model.PendingUpload, error) {
+	var e entity.PendingUpload
+
+	err := db.NewDelete().
+		Model(&e).
+		Where("id = ?", uploadID).
+		Returning("*").
+		Scan(ctx)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.PendingUpload{}, model.ErrUploadAbandoned
+		}
+		return model.PendingUpload{}, fmt.Errorf("delete pending upload: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	upload, err := e.ToModel()
+	if err != nil {
+		return model.PendingUpload{}, fmt.Errorf("convert pending upload to model: %w", err)
+	}
+
+	return upload, nil
+}
+
+// ListStalePendingUploads returns up to limit uploads not refreshed since the given time, oldest first.
+func (db *DB) ListStalePendingUploads(
+	ctx context.Context, updatedBefore time.Time, limit int,
+) ([]model.PendingUpload, error) {
+	var entities []entity.PendingUpload
+
+	err := db.NewSelect().
+		Model(&entities).
+		Where("updated_at < ?", updatedBefore).
+		Order("updated_at").
+		Limit(limit).
+		Scan(ctx)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("select pending uploads: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	uploads := make([]model.PendingUpload, 0, len(entities))
+	for _, e := range entities {
+		upload, err := e.ToModel()
+		if err != nil {
+			return nil, fmt.Errorf("convert pending upload to model: %w", err)
+		}
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, nil
+}
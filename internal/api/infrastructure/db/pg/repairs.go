@@ -0,0 +1,89 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ssimpl/simple-storage/internal/api/infrastructure/db/pg/entity"
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+// CreateRepairs queues the repairs. Objects already queued are skipped.
+func (db *DB) CreateRepairs(ctx context.Context, repairs []model.Repair) error {
+	if len(repairs) == 0 {
+		return nil
+	}
+
+	entities := make([]entity.Repair, 0, len(repairs))
+	for _, r := range repairs {
+		entities = append(entities, entity.RepairFromModel(r))
+	}
+
+	_, err := db.NewInsert().
+		Model(&entities).
+		Column("object_name", "missing").
+		On("CONFLICT (object_name) DO NOTHING").
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("insert repairs: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return nil
+}
+
+// GetRepairs returns all queued and failed repairs, oldest first.
+func (db *DB) GetRepairs(ctx context.Context) ([]model.Repair, error) {
+	var entities []entity.Repair
+
+	err := db.NewSelect().
+		Model(&entities).
+		Order("created_at", "object_name").
+		Scan(ctx)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("select repairs: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	repairs := make([]model.Repair, 0, len(entities))
+	for _, e := range entities {
+		repairs = append(repairs, e.ToModel())
+	}
+
+	return repairs, nil
+}
+
+// UpdateRepair saves the progress, state, attempts and last error of the repair.
+func (db *DB) UpdateRepair(ctx context.Context, repair model.Repair) error {
+	_, err := db.NewUpdate().
+		Model((*entity.Repair)(nil)).
+		Set("missing = ?", repair.Missing).
+		Set("repaired = ?", repair.Repaired).
+		Set("state = ?", repair.State).
+		Set("attempts = ?", repair.Attempts).
+		Set("last_error = ?", repair.LastError).
+		Set("updated_at = NOW()").
+		Where("object_name = ?", repair.ObjectName).
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("update repair: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return nil
+}
+
+func (db *DB) DeleteRepair(ctx context.Context, objectName string) error {
+	_, err := db.NewDelete().
+		Model((*entity.Repair)(nil)).
+		Where("object_name = ?", objectName).
+		Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("delete repair: %w: %w", err, model.ErrDBMalfunctioning)
+	}
+
+	return nil
+}
@@ -2,53 +2,124 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
+	"github.com/ssimpl/simple-storage/internal/api/model"
 	"github.com/ssimpl/simple-storage/pkg/storage"
 
 	"github.com/google/uuid"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 const responseStatusOK = "OK"
 
 const bufferSize = 64000
 
-type Client struct{}
+// minCommitRate is the lowest rate, in bytes per second, a storage server is expected to commit a fragment at.
+// Committing flushes the whole fragment to disk with no progress to report, so its deadline grows with the size.
+const minCommitRate = 1 << 20
 
-func NewClient() *Client {
-	return &Client{}
+const (
+	defaultConnectionTimeout = 5 * time.Second
+	defaultKeepaliveTime     = 30 * time.Second
+	defaultIdleTimeout       = 5 * time.Minute
+)
+
+type Config struct {
+	// ConnectionTimeout bounds connecting to a storage server, unary calls
+	// and the time a storage server may go without progress in a fragment transfer.
+	// Committing an upload gets it plus a second per MB of the fragment.
+	ConnectionTimeout time.Duration
+	// KeepaliveTime is the period of pings checking that a connection is alive while in use.
+	// Storage servers reject pings more frequent than every 10 seconds.
+	KeepaliveTime time.Duration
+	// IdleTimeout is the time after which a connection nobody uses is closed.
+	IdleTimeout time.Duration
+}
+
+func (cfg *Config) SetDefaults() {
+	if cfg.ConnectionTimeout <= 0 {
+		cfg.ConnectionTimeout = defaultConnectionTimeout
+	}
+	if cfg.KeepaliveTime <= 0 {
+		cfg.KeepaliveTime = defaultKeepaliveTime
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = defaultIdleTimeout
+	}
+}
+
+type Client struct {
+	cfg  Config
+	pool *connPool
 }
 
-func (c *Client) Store(ctx context.Context, serverAddr string, objectID uuid.UUID, data io.Reader) error {
-	conn, err := grpc.NewClient(serverAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewClient(cfg Config) *Client {
+	cfg.SetDefaults()
+
+	return &Client{
+		cfg:  cfg,
+		pool: newConnPool(cfg),
+	}
+}
+
+// Close closes connections to storage servers.
+func (c *Client) Close() error {
+	return c.pool.close()
+}
+
+// Store uploads size bytes read from data and returns their hex-encoded SHA-256.
+// The storage server persists the object only if it received exactly these bytes.
+func (c *Client) Store(
+	ctx context.Context, serverAddr string, objectID uuid.UUID, data io.Reader, size int64,
+) (string, error) {
+	conn, release, err := c.pool.acquire(serverAddr)
 	if err != nil {
-		return fmt.Errorf("failed to create grpc client: %w", err)
+		return "", fmt.Errorf("failed to create grpc client: %w", err)
 	}
+	defer release()
+
+	// Leaving without a commit cancels the stream, so the server discards what it received.
+	guard := newStallGuard(ctx, c.cfg.ConnectionTimeout)
+	defer guard.stop()
 
-	stream, err := storage.NewStorageClient(conn).Upload(ctx)
+	checksum, err := upload(guard, storage.NewStorageClient(conn), objectID, data, size)
+	return checksum, guard.check(err)
+}
+
+func upload(
+	guard *stallGuard, client storage.StorageClient, objectID uuid.UUID, data io.Reader, size int64,
+) (string, error) {
+	stream, err := client.Upload(guard.ctx)
 	if err != nil {
-		return fmt.Errorf("failed to open upload stream: %w", err)
+		return "", fmt.Errorf("failed to open upload stream: %w", err)
 	}
 
-	if err := stream.SendMsg(&storage.UploadRequest{ObjectId: objectID.String()}); err != nil {
-		return fmt.Errorf("failed to send upload request: %w", err)
+	if err := stream.Send(&storage.UploadRequest{ObjectId: objectID.String(), Size: size}); err != nil {
+		return "", fmt.Errorf("failed to send upload request: %w", err)
 	}
 
+	hash := sha256.New()
+	var sent int64
 	buffer := make([]byte, bufferSize)
 	for {
 		n, readErr := data.Read(buffer)
 		if readErr != nil && !errors.Is(readErr, io.EOF) {
-			return fmt.Errorf("failed to read data: %w", readErr)
+			return "", fmt.Errorf("failed to read data: %w", readErr)
 		}
 
 		if n > 0 {
+			hash.Write(buffer[:n])
+			sent += int64(n)
 			if err := stream.Send(&storage.UploadRequest{Data: buffer[:n]}); err != nil {
-				return fmt.Errorf("failed to send upload data chunk: %w", err)
+				return "", fmt.Errorf("failed to send upload data chunk: %w", err)
 			}
+			guard.progress()
 		}
 
 		if readErr == io.EOF {
@@ -56,25 +127,53 @@ func (c *Client) Store(ctx context.Context, serverAddr string, objectID uuid.UUI
 		}
 	}
 
+	if sent != size {
+		return "", fmt.Errorf("expected %d bytes, read %d: %w", size, sent, io.ErrUnexpectedEOF)
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if err := stream.Send(&storage.UploadRequest{Commit: &storage.UploadCommit{Checksum: checksum}}); err != nil {
+		return "", fmt.Errorf("failed to send upload commit: %w", err)
+	}
+	guard.await(guard.timeout + time.Duration(size/minCommitRate)*time.Second)
+
 	res, err := stream.CloseAndRecv()
 	if err != nil {
-		return fmt.Errorf("failed to close upload stream: %w", err)
+		return "", fmt.Errorf("failed to close upload stream: %w", err)
 	}
 
 	if res.Status != responseStatusOK {
-		return fmt.Errorf("upload failed: %s", res.Status)
+		return "", fmt.Errorf("upload failed: %s", res.Status)
 	}
 
-	return nil
+	return checksum, nil
 }
 
-func (c *Client) Retrieve(ctx context.Context, serverAddr string, objectID uuid.UUID, dst io.Writer) error {
-	conn, err := grpc.NewClient(serverAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// Retrieve writes length bytes of the object starting at offset to dst.
+// A zero length means reading up to the end of the object.
+func (c *Client) Retrieve(
+	ctx context.Context, serverAddr string, objectID uuid.UUID, offset, length int64, dst io.Writer,
+) error {
+	conn, release, err := c.pool.acquire(serverAddr)
 	if err != nil {
 		return fmt.Errorf("failed to create grpc client: %w", err)
 	}
+	defer release()
+
+	guard := newStallGuard(ctx, c.cfg.ConnectionTimeout)
+	defer guard.stop()
+
+	return guard.check(download(guard, storage.NewStorageClient(conn), objectID, offset, length, dst))
+}
 
-	stream, err := storage.NewStorageClient(conn).Download(ctx, &storage.DownloadRequest{ObjectId: objectID.String()})
+func download(
+	guard *stallGuard, client storage.StorageClient, objectID uuid.UUID, offset, length int64, dst io.Writer,
+) error {
+	stream, err := client.Download(guard.ctx, &storage.DownloadRequest{
+		ObjectId: objectID.String(),
+		Offset:   offset,
+		Length:   length,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to open download stream: %w", err)
 	}
@@ -87,9 +186,136 @@ func (c *Client) Retrieve(ctx context.Context, serverAddr string, objectID uuid.
 			}
 			return fmt.Errorf("failed to receive download data chunk: %w", err)
 		}
+
+		// Only the storage server is timed: writing to dst may block on a slow client for any time.
+		guard.pause()
 		if _, err := dst.Write(res.Data); err != nil {
 			return fmt.Errorf("failed to write data chunk: %w", err)
 		}
+		guard.progress()
+	}
+
+	return nil
+}
+
+func (c *Client) Delete(ctx context.Context, serverAddr string, objectID uuid.UUID) error {
+	conn, release, err := c.pool.acquire(serverAddr)
+	if err != nil {
+		return fmt.Errorf("failed to create grpc client: %w", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.ConnectionTimeout)
+	defer cancel()
+
+	res, err := storage.NewStorageClient(conn).Delete(ctx, &storage.DeleteRequest{ObjectId: objectID.String()})
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+
+	if res.Status != responseStatusOK {
+		return fmt.Errorf("delete failed: %s", res.Status)
+	}
+
+	return nil
+}
+
+func (c *Client) Stat(ctx context.Context, serverAddr string, objectID uuid.UUID) (model.FragmentInfo, error) {
+	conn, release, err := c.pool.acquire(serverAddr)
+	if err != nil {
+		return model.FragmentInfo{}, fmt.Errorf("failed to create grpc client: %w", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.ConnectionTimeout)
+	defer cancel()
+
+	res, err := storage.NewStorageClient(conn).Stat(ctx, &storage.StatRequest{ObjectId: objectID.String()})
+	if err != nil {
+		return model.FragmentInfo{}, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	if !res.GetExists() {
+		return model.FragmentInfo{}, nil
+	}
+
+	return model.FragmentInfo{
+		Exists:   true,
+		Size:     res.GetSize(),
+		ModTime:  res.GetModTime().AsTime(),
+		Checksum: res.GetChecksum(),
+	}, nil
+}
+
+// ListFragments calls fn for every fragment stored on the server. Objects not named by a fragment ID
+// were not written by the API server and are skipped.
+func (c *Client) ListFragments(ctx context.Context, serverAddr string, fn func(entry model.FragmentEntry) error) error {
+	conn, release, err := c.pool.acquire(serverAddr)
+	if err != nil {
+		return fmt.Errorf("failed to create grpc client: %w", err)
+	}
+	defer release()
+
+	guard := newStallGuard(ctx, c.cfg.ConnectionTimeout)
+	defer guard.stop()
+
+	return guard.check(listFragments(guard, storage.NewStorageClient(conn), fn))
+}
+
+func listFragments(
+	guard *stallGuard, client storage.StorageClient, fn func(entry model.FragmentEntry) error,
+) error {
+	stream, err := client.ListFragments(guard.ctx, &storage.ListFragmentsRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to open list stream: %w", err)
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to receive fragments: %w", err)
+		}
+		guard.progress()
+
+		for _, f := range res.GetFragments() {
+			fragmentID, err := uuid.Parse(f.GetObjectId())
+			if err != nil {
+				continue
+			}
+
+			err = fn(model.FragmentEntry{
+				FragmentID: fragmentID,
+				Size:       f.GetSize(),
+				ModTime:    f.GetModTime().AsTime(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// CheckHealth returns an error unless the storage server reports it is serving.
+func (c *Client) CheckHealth(ctx context.Context, serverAddr string) error {
+	conn, release, err := c.pool.acquire(serverAddr)
+	if err != nil {
+		return fmt.Errorf("failed to create grpc client: %w", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.ConnectionTimeout)
+	defer cancel()
+
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to check health: %w", err)
+	}
+
+	if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("server is %s", res.GetStatus())
 	}
 
 	return nil
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+var errClientClosed = errors.New("storage client closed")
+
+// connPool keeps one long-lived connection per storage server address,
+// closing connections nobody used for Config.IdleTimeout.
+type connPool struct {
+	cfg Config
+
+	mu     sync.Mutex
+	conns  map[string]*pooledConn
+	closed bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type pooledConn struct {
+	conn     *grpc.ClientConn
+	active   int
+	lastUsed time.Time
+}
+
+func newConnPool(cfg Config) *connPool {
+	p := &connPool{
+		cfg:   cfg,
+		conns: make(map[string]*pooledConn),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	go p.evictIdle()
+
+	return p
+}
+
+// acquire returns the connection to the address, creating it if needed.
+// The returned function must be called once the connection is no longer used.
+func (p *connPool) acquire(addr string) (*grpc.ClientConn, func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, nil, errClientClosed
+	}
+
+	pc, ok := p.conns[addr]
+	if !ok {
+		conn, err := grpc.NewClient(addr,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithConnectParams(grpc.ConnectParams{
+				Backoff:           backoff.DefaultConfig,
+				MinConnectTimeout: p.cfg.ConnectionTimeout,
+			}),
+			grpc.WithKeepaliveParams(keepalive.ClientParameters{
+				Time:    p.cfg.KeepaliveTime,
+				Timeout: p.cfg.ConnectionTimeout,
+			}),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pc = &pooledConn{conn: conn}
+		p.conns[addr] = pc
+	}
+
+	pc.active++
+
+	return pc.conn, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		pc.active--
+		pc.lastUsed = time.Now()
+	}, nil
+}
+
+func (p *connPool) evictIdle() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.cfg.IdleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		for addr, pc := range p.conns {
+			if pc.active == 0 && time.Since(pc.lastUsed) >= p.cfg.IdleTimeout {
+				_ = pc.conn.Close()
+				delete(p.conns, addr)
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// close closes all connections, interrupting calls still using them.
+func (p *connPool) close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.stop)
+
+	var errs []error
+	for addr, pc := range p.conns {
+		errs = append(errs, pc.conn.Close())
+		delete(p.conns, addr)
+	}
+	p.mu.Unlock()
+
+	<-p.done
+
+	return errors.Join(errs...)
+}
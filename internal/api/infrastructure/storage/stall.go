@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errTransferStalled = errors.New("no progress within connection timeout")
+
+// stallGuard cancels a fragment transfer making no progress for the timeout.
+// Unlike a fixed deadline, it doesn't limit how long transferring a large fragment may take.
+type stallGuard struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func newStallGuard(ctx context.Context, timeout time.Duration) *stallGuard {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	return &stallGuard{
+		ctx:     ctx,
+		cancel:  cancel,
+		timer:   time.AfterFunc(timeout, func() { cancel(errTransferStalled) }),
+		timeout: timeout,
+	}
+}
+
+func (g *stallGuard) progress() {
+	g.timer.Reset(g.timeout)
+}
+
+// pause stops timing the transfer until the next progress, for a step waiting on the other end of it,
+// such as a slow client reading the downloaded data.
+func (g *stallGuard) pause() {
+	g.timer.Stop()
+}
+
+// await gives the transfer the timeout to complete, for a step reporting no progress meanwhile.
+func (g *stallGuard) await(timeout time.Duration) {
+	g.timer.Reset(timeout)
+}
+
+func (g *stallGuard) stop() {
+	g.timer.Stop()
+	g.cancel(nil)
+}
+
+// check reports errors caused by the guard as DeadlineExceeded, so callers can tell them from cancellation.
+func (g *stallGuard) check(err error) error {
+	if err != nil && errors.Is(context.Cause(g.ctx), errTransferStalled) {
+		return status.Error(codes.DeadlineExceeded, fmt.Sprintf("%v: %v", errTransferStalled, err))
+	}
+	return err
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FragmentDeletion is a fragment copy of a replaced version of an object, queued for deletion
+// until downloads that read the metadata of that version have finished.
+type FragmentDeletion struct {
+	ID         uuid.UUID
+	ObjectName string
+	ServerID   uuid.UUID
+	FragmentID uuid.UUID
+	// SizeUnknown marks copies of objects stored before sizes were recorded: their space is released
+	// with the size the server holding them reports, once they are due for deletion.
+	SizeUnknown bool
+	// CreatedAt is when the version was replaced.
+	CreatedAt time.Time
+}
@@ -10,4 +10,16 @@ const (
 	ErrObjectNotFound   Error = "object not found"
 	ErrDBMalfunctioning Error = "db malfunctioning"
 	ErrServerNotFound   Error = "server not found"
+	ErrInvalidRange     Error = "invalid range"
+	ErrChecksumMismatch Error = "checksum mismatch"
+	ErrNotEnoughServers Error = "not enough servers"
+	ErrNotEnoughShards  Error = "not enough shards to restore object"
+	ErrServerAddrEmpty  Error = "server address is required"
+	ErrServerNotEmpty   Error = "server still holds fragments"
+	ErrServerAddrTaken  Error = "server address is taken by another server"
+	ErrFragmentChanged  Error = "fragment changed"
+	ErrFragmentLost     Error = "all replicas of fragment lost"
+	ErrGCRunning        Error = "garbage collection already running"
+	ErrUploadAbandoned  Error = "upload abandoned"
+	ErrSizeMismatch     Error = "size mismatch"
 )
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// GCReport is the outcome of a garbage collection pass over all servers.
+type GCReport struct {
+	// DryRun reports only list the orphaned fragments, without deleting them.
+	DryRun     bool
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Servers    []ServerGCReport
+}
+
+// ServerGCReport describes the fragments found on a server that nothing references.
+type ServerGCReport struct {
+	Server Server
+	// Fragments is the number of fragments listed on the server.
+	Fragments int64
+	// Orphans are unreferenced fragments older than the grace period. The list may be truncated,
+	// OrphanCount and OrphanBytes always cover all of them.
+	Orphans     []FragmentEntry
+	OrphanCount int64
+	OrphanBytes int64
+	Deleted     int64
+	// Error is why the server was skipped or only partly collected, empty if it was not.
+	Error string
+}
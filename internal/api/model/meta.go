@@ -1,15 +1,93 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LayoutScheme string
+
+const (
+	// LayoutReplicated splits an object into consecutive fragments, each stored on Replicas servers.
+	LayoutReplicated LayoutScheme = "replicated"
+	// LayoutErasure splits an object into DataShards consecutive fragments of equal size, the last one
+	// zero-padded, plus ParityShards Reed-Solomon parity fragments. Any DataShards of them restore the object.
+	LayoutErasure LayoutScheme = "erasure"
+)
+
+// Layout describes how an object is spread over fragments.
+type Layout struct {
+	Scheme       LayoutScheme
+	Replicas     int
+	DataShards   int
+	ParityShards int
+}
 
 type ObjectMeta struct {
 	ObjectName string
-	Fragments  []ObjectFragmentMeta
+	Size       int64
+	Layout     Layout
+	// Checksum is the hex-encoded SHA-256 of the whole object, empty for objects stored before checksums existed.
+	Checksum  string
+	Fragments []ObjectFragmentMeta
+	// SizeUnknown is set for objects stored before sizes were recorded, until their sizes are backfilled
+	// from the storage servers: Size and the FragmentSize of their fragments are 0 then,
+	// and the object can only be read in full.
+	SizeUnknown bool
 }
 
+// ObjectFragmentMeta describes one copy of a fragment. Replicas of the same fragment
+// share SeqNum, FragmentID and content, and differ by Replica and ServerID.
 type ObjectFragmentMeta struct {
 	SeqNum       int
+	Replica      int
 	ServerID     uuid.UUID
 	FragmentID   uuid.UUID
 	FragmentSize int64
+	// Checksum is the hex-encoded SHA-256 of the fragment content.
+	Checksum string
+}
+
+// ReplicaGroups returns fragments grouped by SeqNum, in SeqNum order,
+// each group holding the replicas of one fragment in Replica order.
+func (m ObjectMeta) ReplicaGroups() [][]ObjectFragmentMeta {
+	fragments := slices.Clone(m.Fragments)
+	slices.SortFunc(fragments, func(a, b ObjectFragmentMeta) int {
+		return cmp.Or(cmp.Compare(a.SeqNum, b.SeqNum), cmp.Compare(a.Replica, b.Replica))
+	})
+
+	var groups [][]ObjectFragmentMeta
+	for i, f := range fragments {
+		if i == 0 || f.SeqNum != fragments[i-1].SeqNum {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], f)
+	}
+
+	return groups
+}
+
+// ContentDigests holds digests of the object content declared by the client.
+// Empty digests are not checked.
+type ContentDigests struct {
+	MD5    []byte
+	SHA256 []byte
+}
+
+// FragmentInfo describes a fragment as reported by the storage server holding it.
+type FragmentInfo struct {
+	Exists   bool
+	Size     int64
+	ModTime  time.Time
+	Checksum string
+}
+
+// FragmentEntry is a fragment listed by the storage server holding it.
+type FragmentEntry struct {
+	FragmentID uuid.UUID
+	Size       int64
+	ModTime    time.Time
 }
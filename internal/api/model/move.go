@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MoveReason string
+
+const (
+	MoveRebalance MoveReason = "rebalance"
+	// MoveDrain moves fragments off draining servers.
+	MoveDrain MoveReason = "drain"
+)
+
+type MoveState string
+
+const (
+	// MovePending moves are copying the fragment to the target server.
+	MovePending MoveState = "pending"
+	// MoveSwitched moves have the object metadata pointing at the target server
+	// and wait for the source copy to be deleted.
+	MoveSwitched MoveState = "switched"
+	// MoveFailed moves gave up after too many failed attempts.
+	MoveFailed MoveState = "failed"
+)
+
+// FragmentMove is a fragment copy being moved from one server to another.
+type FragmentMove struct {
+	ID             uuid.UUID
+	ObjectName     string
+	SeqNum         int
+	FragmentID     uuid.UUID
+	FragmentSize   int64
+	Checksum       string
+	SourceServerID uuid.UUID
+	TargetServerID uuid.UUID
+	Reason         MoveReason
+	State          MoveState
+	Attempts       int
+	LastError      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
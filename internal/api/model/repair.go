@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+type RepairState string
+
+const (
+	// RepairPending repairs are waiting for, or in the middle of, rebuilding lost fragments.
+	RepairPending RepairState = "pending"
+	// RepairFailed repairs gave up after too many failed attempts, or because too few fragments survived.
+	RepairFailed RepairState = "failed"
+)
+
+// Repair is an object with lost fragment copies queued for rebuilding.
+type Repair struct {
+	ObjectName string
+	// Missing is the number of fragment copies found lost, Repaired the number of them rebuilt so far.
+	Missing   int
+	Repaired  int
+	State     RepairState
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
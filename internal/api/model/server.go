@@ -1,9 +1,125 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ServerStatus string
+
+const (
+	ServerActive ServerStatus = "active"
+	// ServerCordoned servers keep serving their fragments but get no new ones.
+	ServerCordoned ServerStatus = "cordoned"
+	// ServerDraining servers get no new fragments and have theirs moved to other servers, so they can be removed.
+	ServerDraining ServerStatus = "draining"
+)
+
+// Labels locating a server, reported by the server on registration.
+const (
+	LabelZone = "zone"
+	LabelRack = "rack"
+)
 
 type Server struct {
 	ID        uuid.UUID
 	Addr      string
+	Status    ServerStatus
 	UsedSpace int64
+	// Capacity is the storage capacity in bytes reported by the server, 0 if unknown.
+	Capacity int64
+	Labels   map[string]string
+	// LastHeartbeatAt is zero for servers that never sent a heartbeat.
+	LastHeartbeatAt time.Time
+	// FirstHeartbeatAt is when the server first registered or sent a heartbeat, zero if unknown.
+	FirstHeartbeatAt time.Time
+	// Stale servers stopped sending heartbeats and get no new fragments.
+	Stale bool
+	// Static servers were added through the admin API and are not expected to send heartbeats:
+	// they are never marked stale, and only health checks tell whether they are up.
+	Static bool
+}
+
+// Schedulable reports whether new fragments may be placed on the server.
+func (s Server) Schedulable() bool {
+	return !s.Stale && s.Status != ServerCordoned && s.Status != ServerDraining
+}
+
+// ServerOverview is the state of a server as seen by cluster administrators.
+type ServerOverview struct {
+	Server        Server
+	Health        HealthState
+	FragmentCount int64
+}
+
+type ClusterStats struct {
+	Servers     int
+	Objects     int64
+	ObjectBytes int64
+	// UsedSpace is the space taken by fragments, including replicas and parity.
+	UsedSpace int64
+	Capacity  int64
+	// UsedSpaceCV is the coefficient of variation of used space across servers:
+	// 0 when usage is even, growing as it gets uneven.
+	UsedSpaceCV float64
+	// UtilizationSpread is the difference between the highest and the lowest share of capacity used
+	// among servers with a known capacity.
+	UtilizationSpread float64
+}
+
+// PlacementViolation is an object that could become unreadable by losing a single failure domain.
+type PlacementViolation struct {
+	ObjectName string
+	Layout     LayoutScheme
+	// Reasons describe which fragments are at risk.
+	Reasons []string
+}
+
+type ObjectStats struct {
+	Count int64
+	Bytes int64
+}
+
+type FragmentStats struct {
+	Count int64
+	Bytes int64
+}
+
+// DrainProgress is how far moving the fragments off a server has got.
+type DrainProgress struct {
+	Server Server
+	// Remaining are the fragments objects still reference on the server.
+	Remaining     FragmentStats
+	PendingMoves  int
+	SwitchedMoves int
+	FailedMoves   int
+}
+
+// Done reports whether no object references the server anymore, so it can be removed.
+func (p DrainProgress) Done() bool {
+	return p.Remaining.Count == 0
+}
+
+type HealthState string
+
+const (
+	// HealthUnknown is the state of servers not probed yet.
+	HealthUnknown HealthState = "unknown"
+	HealthUp      HealthState = "up"
+	// HealthDegraded is the state of servers answering slowly or failing some probes.
+	HealthDegraded HealthState = "degraded"
+	HealthDown     HealthState = "down"
+)
+
+type ServerHealth struct {
+	Server    Server
+	State     HealthState
+	Since     time.Time
+	LastCheck time.Time
+	Latency   time.Duration
+	LastError string
+	// ConsecutiveFailures and ConsecutiveSuccesses count the latest probes with the same outcome.
+	ConsecutiveFailures  int
+	ConsecutiveSuccesses int
 }
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PendingUpload is an upload journaled until its object metadata is saved, so the fragments stored
+// for it can be deleted if it fails or is abandoned.
+type PendingUpload struct {
+	ID         uuid.UUID
+	ObjectName string
+	Size       int64
+	// Fragments are the fragment copies stored so far.
+	Fragments []ObjectFragmentMeta
+	CreatedAt time.Time
+	// UpdatedAt is when the upload was last refreshed, which running uploads do periodically.
+	UpdatedAt time.Time
+}
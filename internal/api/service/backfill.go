@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+const (
+	// backfillRetryInterval is the period of retrying objects whose sizes failed to be backfilled.
+	backfillRetryInterval = 10 * time.Minute
+
+	// backfillLockKey is the advisory lock key letting a single API server backfill object sizes at a time.
+	backfillLockKey int64 = 0x5353_0006
+)
+
+type backfillRepository interface {
+	GetServers(ctx context.Context) ([]model.Server, error)
+	ListUnsizedObjects(ctx context.Context, after string, limit int) ([]model.ObjectMeta, error)
+	SetObjectSizes(ctx context.Context, meta model.ObjectMeta) error
+	TryLock(ctx context.Context, key int64) (func(), bool, error)
+}
+
+// SizeBackfiller records the sizes of objects stored before sizes were, taking them from the storage servers
+// holding their fragments. Until then, such objects are only served in full and can't be repaired or moved.
+type SizeBackfiller struct {
+	storage fragmentStorage
+	repo    backfillRepository
+}
+
+func NewSizeBackfiller(storage fragmentStorage, repo backfillRepository) *SizeBackfiller {
+	return &SizeBackfiller{
+		storage: storage,
+		repo:    repo,
+	}
+}
+
+// Run backfills object sizes right away, then retries those that failed every backfillRetryInterval
+// until none is left or the context is canceled. Only one API server sharing the database does it at a time.
+func (b *SizeBackfiller) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		done, err := b.backfill(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Object size backfill failed", "err", err)
+		}
+		if done {
+			return
+		}
+		timer.Reset(backfillRetryInterval)
+	}
+}
+
+// backfill records the sizes of all unsized objects it can and reports whether none is left.
+func (b *SizeBackfiller) backfill(ctx context.Context) (bool, error) {
+	release, acquired, err := b.repo.TryLock(ctx, backfillLockKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to take backfill lock: %w", err)
+	}
+	if !acquired {
+		return false, nil
+	}
+	defer release()
+
+	servers, err := b.repo.GetServers(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	serversByID := make(map[uuid.UUID]model.Server, len(servers))
+	for _, s := range servers {
+		serversByID[s.ID] = s
+	}
+
+	var (
+		after            string
+		sized, remaining int
+	)
+	for {
+		objects, err := b.repo.ListUnsizedObjects(ctx, after, objectBatchSize)
+		if err != nil {
+			return false, fmt.Errorf("failed to list unsized objects: %w", err)
+		}
+
+		for _, meta := range objects {
+			if err := b.sizeObject(ctx, serversByID, meta); err != nil {
+				if ctx.Err() != nil {
+					return false, ctx.Err()
+				}
+				slog.Warn("Failed to backfill object size", "object", meta.ObjectName, "err", err)
+				remaining++
+				continue
+			}
+			sized++
+		}
+
+		if len(objects) < objectBatchSize {
+			break
+		}
+		after = objects[len(objects)-1].ObjectName
+	}
+
+	if sized > 0 || remaining > 0 {
+		slog.Info("Object sizes backfilled", "objects", sized, "remaining", remaining)
+	}
+
+	return remaining == 0, nil
+}
+
+// sizeObject takes the size of every fragment of the object from a copy of it and records them.
+func (b *SizeBackfiller) sizeObject(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, meta model.ObjectMeta,
+) error {
+	sizes := make(map[int]int64)
+	for _, replicas := range meta.ReplicaGroups() {
+		size, err := b.statFragment(ctx, serversByID, replicas)
+		if err != nil {
+			return fmt.Errorf("fragment %d: %w", replicas[0].SeqNum, err)
+		}
+		sizes[replicas[0].SeqNum] = size
+	}
+
+	sized := meta
+	sized.Fragments = slices.Clone(meta.Fragments)
+	for i := range sized.Fragments {
+		sized.Fragments[i].FragmentSize = sizes[sized.Fragments[i].SeqNum]
+	}
+	for _, size := range sizes {
+		sized.Size += size
+	}
+
+	if err := b.repo.SetObjectSizes(ctx, sized); err != nil {
+		return fmt.Errorf("failed to save sizes: %w", err)
+	}
+
+	return nil
+}
+
+// statFragment returns the size of the fragment as reported by the first server holding a copy of it.
+func (b *SizeBackfiller) statFragment(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, replicas []model.ObjectFragmentMeta,
+) (int64, error) {
+	var errs []error
+	for _, r := range replicas {
+		server, ok := serversByID[r.ServerID]
+		if !ok {
+			errs = append(errs, fmt.Errorf("server '%s' not found: %w", r.ServerID, model.ErrServerNotFound))
+			continue
+		}
+
+		info, err := b.storage.Stat(ctx, server.Addr, r.FragmentID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("server '%s': %w", server.Addr, err))
+			continue
+		}
+		if !info.Exists {
+			errs = append(errs, fmt.Errorf("server '%s': %w", server.Addr, model.ErrObjectNotFound))
+			continue
+		}
+
+		return info.Size, nil
+	}
+
+	return 0, errors.Join(errs...)
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"bytes"
+	"crypto/md5" //nolint:gosec // MD5 is only used to check the Content-MD5 header sent by clients.
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+// contentHasher computes the SHA-256 of the content written to it,
+// and its MD5 when the client declared one to check it against.
+type contentHasher struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+func newContentHasher(expected model.ContentDigests) *contentHasher {
+	h := &contentHasher{sha256: sha256.New()}
+	if len(expected.MD5) > 0 {
+		h.md5 = md5.New() //nolint:gosec // See import comment.
+	}
+	return h
+}
+
+func (h *contentHasher) Write(p []byte) (int, error) {
+	h.sha256.Write(p)
+	if h.md5 != nil {
+		h.md5.Write(p)
+	}
+	return len(p), nil
+}
+
+func (h *contentHasher) Checksum() string {
+	return hex.EncodeToString(h.sha256.Sum(nil))
+}
+
+func (h *contentHasher) Verify(expected model.ContentDigests) error {
+	if len(expected.SHA256) > 0 && !bytes.Equal(expected.SHA256, h.sha256.Sum(nil)) {
+		return fmt.Errorf("declared SHA-256 does not match content: %w", model.ErrChecksumMismatch)
+	}
+	if len(expected.MD5) > 0 && !bytes.Equal(expected.MD5, h.md5.Sum(nil)) {
+		return fmt.Errorf("declared MD5 does not match content: %w", model.ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// checksumWriter passes data through to dst while computing its SHA-256.
+type checksumWriter struct {
+	dst  io.Writer
+	hash hash.Hash
+}
+
+func newChecksumWriter(dst io.Writer) *checksumWriter {
+	return &checksumWriter{dst: dst, hash: sha256.New()}
+}
+
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	n, err := w.dst.Write(p)
+	w.hash.Write(p[:n])
+	return n, err
+}
+
+func (w *checksumWriter) Verify(expected string) error {
+	if actual := hex.EncodeToString(w.hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("expected %s, got %s: %w", expected, actual, model.ErrChecksumMismatch)
+	}
+	return nil
+}
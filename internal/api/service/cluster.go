@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+type clusterRepository interface {
+	GetServers(ctx context.Context) ([]model.Server, error)
+	SetServerStatus(ctx context.Context, serverID uuid.UUID, status model.ServerStatus) error
+	DeleteServer(ctx context.Context, serverID uuid.UUID) error
+	GetFragmentCounts(ctx context.Context) (map[uuid.UUID]int64, error)
+	GetObjectStats(ctx context.Context) (model.ObjectStats, error)
+	ListObjectMeta(ctx context.Context, after string, limit int) ([]model.ObjectMeta, error)
+	GetFragmentMoves(ctx context.Context) ([]model.FragmentMove, error)
+	GetServerFragmentStats(ctx context.Context, serverID uuid.UUID) (model.FragmentStats, error)
+	GetRepairs(ctx context.Context) ([]model.Repair, error)
+}
+
+const objectBatchSize = 1000
+
+// ClusterManager gives administrators a view of the cluster and lets them change its membership.
+type ClusterManager struct {
+	repo          clusterRepository
+	registry      *Registry
+	health        serverHealth
+	failureDomain FailureDomain
+	replicas      int
+}
+
+// NewClusterManager creates a cluster manager judging placement by the failure domain and the number of replicas
+// new objects are stored with.
+func NewClusterManager(
+	repo clusterRepository, registry *Registry, health serverHealth, failureDomain FailureDomain, replicas int,
+) *ClusterManager {
+	return &ClusterManager{
+		repo:          repo,
+		registry:      registry,
+		health:        health,
+		failureDomain: failureDomain,
+		replicas:      replicas,
+	}
+}
+
+// ListServers returns all servers ordered by address.
+func (c *ClusterManager) ListServers(ctx context.Context) ([]model.ServerOverview, error) {
+	servers, err := c.repo.GetServers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	counts, err := c.repo.GetFragmentCounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fragment counts: %w", err)
+	}
+
+	overviews := make([]model.ServerOverview, 0, len(servers))
+	for _, s := range servers {
+		overviews = append(overviews, model.ServerOverview{
+			Server:        s,
+			Health:        c.health.State(s.ID),
+			FragmentCount: counts[s.ID],
+		})
+	}
+
+	sort.Slice(overviews, func(i, j int) bool {
+		return overviews[i].Server.Addr < overviews[j].Server.Addr
+	})
+
+	return overviews, nil
+}
+
+// AddServer adds the server to the cluster the same way a registering server does, as a static one:
+// it is not expected to send heartbeats, and health checks tell whether it is up.
+// A server registering itself with the same address afterwards is tracked by heartbeats again.
+func (c *ClusterManager) AddServer(ctx context.Context, server model.Server) (model.Server, error) {
+	server.Static = true
+	return c.registry.Register(ctx, server)
+}
+
+// RemoveServer removes the server from the cluster. Servers still holding fragments can't be removed,
+// they have to be drained first. A running server registers again with its next heartbeat,
+// so it has to be stopped first.
+func (c *ClusterManager) RemoveServer(ctx context.Context, serverID uuid.UUID) error {
+	if err := c.repo.DeleteServer(ctx, serverID); err != nil {
+		return fmt.Errorf("failed to remove server: %w", err)
+	}
+
+	slog.Info("Server removed", "server_id", serverID)
+
+	return nil
+}
+
+// SetServerStatus changes whether new fragments are placed on the server. Cordoned servers keep the fragments
+// they have, draining ones have them moved to other servers by the Rebalancer, see DrainProgress.
+// Making the server active again stops planning moves off it.
+func (c *ClusterManager) SetServerStatus(ctx context.Context, serverID uuid.UUID, status model.ServerStatus) error {
+	if err := c.repo.SetServerStatus(ctx, serverID, status); err != nil {
+		return fmt.Errorf("failed to set server status: %w", err)
+	}
+
+	slog.Info("Server status changed", "server_id", serverID, "status", status)
+
+	return nil
+}
+
+// DrainProgress returns what is left on the server and the state of moves off it.
+func (c *ClusterManager) DrainProgress(ctx context.Context, serverID uuid.UUID) (model.DrainProgress, error) {
+	servers, err := c.repo.GetServers(ctx)
+	if err != nil {
+		return model.DrainProgress{}, fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	idx := slices.IndexFunc(servers, func(s model.Server) bool { return s.ID == serverID })
+	if idx < 0 {
+		return model.DrainProgress{}, model.ErrServerNotFound
+	}
+
+	progress := model.DrainProgress{Server: servers[idx]}
+
+	progress.Remaining, err = c.repo.GetServerFragmentStats(ctx, serverID)
+	if err != nil {
+		return model.DrainProgress{}, fmt.Errorf("failed to get server fragment stats: %w", err)
+	}
+
+	moves, err := c.repo.GetFragmentMoves(ctx)
+	if err != nil {
+		return model.DrainProgress{}, fmt.Errorf("failed to get fragment moves: %w", err)
+	}
+
+	for _, m := range moves {
+		if m.SourceServerID != serverID {
+			continue
+		}
+		switch m.State {
+		case model.MovePending:
+			progress.PendingMoves++
+		case model.MoveSwitched:
+			progress.SwitchedMoves++
+		case model.MoveFailed:
+			progress.FailedMoves++
+		}
+	}
+
+	return progress, nil
+}
+
+// Stats returns cluster-wide totals and how evenly the used space is spread across servers.
+func (c *ClusterManager) Stats(ctx context.Context) (model.ClusterStats, error) {
+	servers, err := c.repo.GetServers(ctx)
+	if err != nil {
+		return model.ClusterStats{}, fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	objects, err := c.repo.GetObjectStats(ctx)
+	if err != nil {
+		return model.ClusterStats{}, fmt.Errorf("failed to get object stats: %w", err)
+	}
+
+	stats := model.ClusterStats{
+		Servers:     len(servers),
+		Objects:     objects.Count,
+		ObjectBytes: objects.Bytes,
+	}
+
+	minUtilization, maxUtilization := math.Inf(1), math.Inf(-1)
+	for _, s := range servers {
+		stats.UsedSpace += s.UsedSpace
+		stats.Capacity += s.Capacity
+
+		if s.Capacity > 0 {
+			utilization := float64(s.UsedSpace) / float64(s.Capacity)
+			minUtilization = min(minUtilization, utilization)
+			maxUtilization = max(maxUtilization, utilization)
+		}
+	}
+	if maxUtilization >= minUtilization {
+		stats.UtilizationSpread = maxUtilization - minUtilization
+	}
+
+	if len(servers) > 0 && stats.UsedSpace > 0 {
+		mean := float64(stats.UsedSpace) / float64(len(servers))
+
+		var variance float64
+		for _, s := range servers {
+			d := float64(s.UsedSpace) - mean
+			variance += d * d
+		}
+		variance /= float64(len(servers))
+
+		stats.UsedSpaceCV = math.Sqrt(variance) / mean
+	}
+
+	return stats, nil
+}
+
+// Moves returns queued, switched and failed fragment moves, oldest first.
+func (c *ClusterManager) Moves(ctx context.Context) ([]model.FragmentMove, error) {
+	moves, err := c.repo.GetFragmentMoves(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fragment moves: %w", err)
+	}
+
+	return moves, nil
+}
+
+// Repairs returns the objects queued for rebuilding lost fragments and the failed repairs, oldest first.
+func (c *ClusterManager) Repairs(ctx context.Context) ([]model.Repair, error) {
+	repairs, err := c.repo.GetRepairs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repairs: %w", err)
+	}
+
+	return repairs, nil
+}
+
+// PlacementViolations returns up to limit objects with names after the given one that would become unreadable
+// by losing a single failure domain, judged by the current labels of their servers, ordered by name.
+// The name of the last one is returned to continue from when there may be more, otherwise an empty string.
+func (c *ClusterManager) PlacementViolations(
+	ctx context.Context, after string, limit int,
+) ([]model.PlacementViolation, string, error) {
+	servers, err := c.repo.GetServers(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	serversByID := make(map[uuid.UUID]model.Server, len(servers))
+	for _, s := range servers {
+		serversByID[s.ID] = s
+	}
+
+	var violations []model.PlacementViolation
+	for {
+		metas, err := c.repo.ListObjectMeta(ctx, after, objectBatchSize)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		for _, meta := range metas {
+			reasons := c.failureDomain.placementViolations(meta, serversByID, c.replicas)
+			if len(reasons) == 0 {
+				continue
+			}
+
+			violations = append(violations, model.PlacementViolation{
+				ObjectName: meta.ObjectName,
+				Layout:     meta.Layout.Scheme,
+				Reasons:    reasons,
+			})
+			if len(violations) == limit {
+				return violations, meta.ObjectName, nil
+			}
+		}
+
+		if len(metas) < objectBatchSize {
+			return violations, "", nil
+		}
+		after = metas[len(metas)-1].ObjectName
+	}
+}
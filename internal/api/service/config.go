@@ -0,0 +1,141 @@
+package service
+
+import (
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+const (
+	defaultFragmentCount      = 6
+	defaultReplicas           = 1
+	defaultFragmentBufferSize = 64 << 20
+	defaultDataShards         = 4
+	defaultParityShards       = 2
+	defaultUploadParallelism  = 4
+	defaultPrefetchDepth      = 4
+	defaultPrefetchMemory     = 256 << 20
+	defaultDownloadTimeout    = time.Hour
+
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 2 * time.Second
+)
+
+// DefaultRetryableCodes are gRPC codes of errors usually caused by a temporary condition of a storage server.
+var DefaultRetryableCodes = []codes.Code{
+	codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.DeadlineExceeded,
+}
+
+type Config struct {
+	// Layout selects how new objects are spread over fragments. Stored objects keep the layout they were written with.
+	Layout model.LayoutScheme
+	// FragmentCount is the number of fragments an object is split into with the replicated layout.
+	FragmentCount int
+	// Replicas is the number of distinct servers each fragment is written to with the replicated layout.
+	Replicas int
+	// DataShards and ParityShards are the Reed-Solomon parameters of the erasure layout.
+	DataShards   int
+	ParityShards int
+	// Placement ranks servers for new fragments. Defaults to LeastUsedPlacement.
+	Placement Placement
+	// AllowColocation lets replicas of different fragments of an object share a server when there are fewer servers
+	// than fragment replicas. By default all of them go to distinct servers, unless there are too few servers:
+	// the object is then stored as with AllowColocation, with a warning. Replicas of one fragment
+	// and erasure-coded shards are always on distinct servers.
+	AllowColocation bool
+	// FailureDomain is the level fragments are spread across, so losing a single failure domain leaves objects
+	// readable: replicas of a fragment go to distinct domains, and no domain gets more shards than there are parity ones.
+	// Defaults to FailureDomainRack.
+	FailureDomain FailureDomain
+	// UploadParallelism is the maximum number of fragments of an object uploaded at once.
+	UploadParallelism int
+	// SpoolDir holds temporary files of fragments being uploaded, and of downloaded fragments too large to be
+	// buffered in memory. Empty means the default temp directory.
+	SpoolDir string
+	// FragmentBufferSize is the maximum size of a fragment buffered on download,
+	// so it is verified before being sent and a corrupted replica can be replaced by another one.
+	// Larger fragments are spooled to SpoolDir instead.
+	FragmentBufferSize int64
+	// PrefetchDepth is the maximum number of fragments of an object downloaded ahead of the one being sent.
+	PrefetchDepth int
+	// PrefetchMemory is the maximum number of bytes buffered by fragments downloaded ahead, by all downloads
+	// together. Larger fragments are not downloaded ahead.
+	PrefetchMemory int64
+	// DownloadTimeout is the maximum time a download may take. Fragments an object stops referencing are kept
+	// at least that long, so downloads that read its metadata before can finish.
+	DownloadTimeout time.Duration
+	// Retry is the policy of retrying fragment transfers failing with transient errors.
+	Retry RetryPolicy
+}
+
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a transfer with one server, including the first one.
+	// Uploads still failing move to another server.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubled for every next one up to MaxBackoff.
+	// Delays are randomized between half and the full value.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Budget is the maximum time spent on attempts of a transfer with one server. Zero means no limit.
+	Budget time.Duration
+	// RetryableCodes are gRPC codes of errors worth retrying.
+	RetryableCodes []codes.Code
+}
+
+func (cfg *Config) SetDefaults() {
+	if cfg.Layout == "" {
+		cfg.Layout = model.LayoutReplicated
+	}
+	if cfg.Placement == nil {
+		cfg.Placement = LeastUsedPlacement{}
+	}
+	if cfg.FailureDomain == "" {
+		cfg.FailureDomain = FailureDomainRack
+	}
+	if cfg.FragmentCount <= 0 {
+		cfg.FragmentCount = defaultFragmentCount
+	}
+	if cfg.Replicas <= 0 {
+		cfg.Replicas = defaultReplicas
+	}
+	if cfg.DataShards <= 0 {
+		cfg.DataShards = defaultDataShards
+	}
+	if cfg.ParityShards <= 0 {
+		cfg.ParityShards = defaultParityShards
+	}
+	if cfg.UploadParallelism <= 0 {
+		cfg.UploadParallelism = defaultUploadParallelism
+	}
+	if cfg.FragmentBufferSize <= 0 {
+		cfg.FragmentBufferSize = defaultFragmentBufferSize
+	}
+	if cfg.PrefetchDepth <= 0 {
+		cfg.PrefetchDepth = defaultPrefetchDepth
+	}
+	if cfg.PrefetchMemory <= 0 {
+		cfg.PrefetchMemory = defaultPrefetchMemory
+	}
+	if cfg.DownloadTimeout <= 0 {
+		cfg.DownloadTimeout = defaultDownloadTimeout
+	}
+	cfg.Retry.SetDefaults()
+}
+
+func (p *RetryPolicy) SetDefaults() {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = max(defaultRetryMaxBackoff, p.InitialBackoff)
+	}
+	if p.RetryableCodes == nil {
+		p.RetryableCodes = DefaultRetryableCodes
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+const (
+	defaultFragmentDeleteInterval = time.Minute
+	defaultFragmentDeleteDelay    = defaultDownloadTimeout
+
+	// fragmentDeleterLockKey is the advisory lock key letting a single API server delete replaced fragments.
+	fragmentDeleterLockKey int64 = 0x5353_0005
+)
+
+type deletionRepository interface {
+	GetServers(ctx context.Context) ([]model.Server, error)
+	ListFragmentDeletions(ctx context.Context, createdBefore time.Time, limit int) ([]model.FragmentDeletion, error)
+	DeleteFragmentDeletion(ctx context.Context, deletionID uuid.UUID) error
+	ReleaseFragmentDeletionSpace(ctx context.Context, deletion model.FragmentDeletion, size int64) error
+	TryLock(ctx context.Context, key int64) (func(), bool, error)
+	fragmentReferences
+}
+
+type FragmentDeletionConfig struct {
+	// Interval is the period of deleting the queued fragments.
+	Interval time.Duration
+	// Delay is the time fragments of a replaced or deleted object version are kept,
+	// so downloads already started can finish. It must be at least Config.DownloadTimeout.
+	Delay time.Duration
+}
+
+func (cfg *FragmentDeletionConfig) SetDefaults() {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultFragmentDeleteInterval
+	}
+	if cfg.Delay <= 0 {
+		cfg.Delay = defaultFragmentDeleteDelay
+	}
+}
+
+// FragmentDeleter deletes the fragments of object versions replaced by an upload or deleted from storage servers.
+type FragmentDeleter struct {
+	storage fragmentStorage
+	repo    deletionRepository
+	cfg     FragmentDeletionConfig
+}
+
+func NewFragmentDeleter(storage fragmentStorage, repo deletionRepository, cfg FragmentDeletionConfig) *FragmentDeleter {
+	cfg.SetDefaults()
+
+	return &FragmentDeleter{
+		storage: storage,
+		repo:    repo,
+		cfg:     cfg,
+	}
+}
+
+// Run deletes queued fragments until the context is canceled. Only one API server sharing the database
+// does it at a time.
+func (d *FragmentDeleter) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		release, acquired, err := d.repo.TryLock(ctx, fragmentDeleterLockKey)
+		if err != nil {
+			slog.Error("Failed to take fragment deleter lock", "err", err)
+			continue
+		}
+		if !acquired {
+			continue
+		}
+
+		if err := d.deleteQueued(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Fragment deletion failed", "err", err)
+		}
+		release()
+	}
+}
+
+// deleteQueued deletes up to objectBatchSize fragments queued for longer than the delay, the oldest first;
+// the rest wait for the next round. Fragments failing to be deleted stay queued.
+func (d *FragmentDeleter) deleteQueued(ctx context.Context) error {
+	deletions, err := d.repo.ListFragmentDeletions(ctx, time.Now().Add(-d.cfg.Delay), objectBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to list fragment deletions: %w", err)
+	}
+	if len(deletions) == 0 {
+		return nil
+	}
+
+	servers, err := d.repo.GetServers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	serversByID := make(map[uuid.UUID]model.Server, len(servers))
+	for _, s := range servers {
+		serversByID[s.ID] = s
+	}
+
+	for _, del := range deletions {
+		// Fragments of a removed server went away with it.
+		if server, ok := serversByID[del.ServerID]; ok {
+			if err := d.releaseUnsized(ctx, server, del); err != nil {
+				slog.Error("Failed to release space of queued fragment", "object", del.ObjectName,
+					"server_id", server.ID, "fragment_id", del.FragmentID, "err", err)
+				continue
+			}
+			if err := deleteUnreferenced(ctx, d.storage, d.repo, server, del.FragmentID); err != nil {
+				slog.Error("Failed to delete queued fragment", "object", del.ObjectName, "server_id", server.ID,
+					"fragment_id", del.FragmentID, "err", err)
+				continue
+			}
+		}
+
+		if err := d.repo.DeleteFragmentDeletion(ctx, del.ID); err != nil {
+			return fmt.Errorf("failed to dequeue fragment deletion: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// releaseUnsized releases the space of a queued copy of an object stored before sizes were recorded,
+// taking its size from the server, before the copy is deleted and its size is gone with it.
+func (d *FragmentDeleter) releaseUnsized(ctx context.Context, server model.Server, del model.FragmentDeletion) error {
+	if !del.SizeUnknown {
+		return nil
+	}
+
+	referenced, err := d.repo.IsFragmentReferenced(ctx, server.ID, del.FragmentID)
+	if err != nil || referenced {
+		return err
+	}
+
+	info, err := d.storage.Stat(ctx, server.Addr, del.FragmentID)
+	if err != nil {
+		return fmt.Errorf("failed to check fragment: %w", err)
+	}
+	if !info.Exists {
+		return nil
+	}
+
+	return d.repo.ReleaseFragmentDeletionSpace(ctx, del, info.Size)
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+// FailureDomain is the level of server groups that may fail together, like a rack losing power.
+type FailureDomain string
+
+const (
+	// FailureDomainServer treats every server as a failure domain of its own.
+	FailureDomainServer FailureDomain = "server"
+	FailureDomainRack   FailureDomain = "rack"
+	FailureDomainZone   FailureDomain = "zone"
+)
+
+func ParseFailureDomain(s string) (FailureDomain, error) {
+	switch d := FailureDomain(s); d {
+	case FailureDomainServer, FailureDomainRack, FailureDomainZone:
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown failure domain '%s'", s)
+	}
+}
+
+// domainOf returns the failure domain of the server from its zone and rack labels.
+// Without a rack label the zone is used, and a server with no labels is a failure domain of its own.
+func (d FailureDomain) domainOf(server model.Server) string {
+	zone, rack := server.Labels[model.LabelZone], server.Labels[model.LabelRack]
+
+	switch {
+	case d == FailureDomainRack && rack != "" && zone != "":
+		return "rack " + zone + "/" + rack
+	case d == FailureDomainRack && rack != "":
+		return "rack " + rack
+	case (d == FailureDomainRack || d == FailureDomainZone) && zone != "":
+		return "zone " + zone
+	default:
+		return "server " + server.ID.String()
+	}
+}
+
+// placementViolations returns why the object would become unreadable by losing a single failure domain,
+// nothing if it would not. Servers missing from serversByID are failure domains of their own.
+// Fragments with a single replica are reported only when the object was stored with more, or replicas,
+// the configured number of replicas, is above one; 0 judges by the layout of the object alone.
+func (d FailureDomain) placementViolations(
+	meta model.ObjectMeta, serversByID map[uuid.UUID]model.Server, replicas int,
+) []string {
+	domainOf := func(serverID uuid.UUID) string {
+		server, ok := serversByID[serverID]
+		if !ok {
+			server = model.Server{ID: serverID}
+		}
+		return d.domainOf(server)
+	}
+
+	var reasons []string
+	if meta.Layout.Scheme == model.LayoutErasure {
+		shards := make(map[string]int)
+		for _, f := range meta.Fragments {
+			shards[domainOf(f.ServerID)]++
+		}
+		for _, domain := range sortedKeys(shards) {
+			if shards[domain] > meta.Layout.ParityShards {
+				reasons = append(reasons, fmt.Sprintf("%s holds %d shards, more than the %d parity shards",
+					domain, shards[domain], meta.Layout.ParityShards))
+			}
+		}
+		return reasons
+	}
+
+	singleReplicaAllowed := max(replicas, meta.Layout.Replicas) < 2
+
+	fragmentDomains := make(map[int]map[string]int)
+	for _, f := range meta.Fragments {
+		if fragmentDomains[f.SeqNum] == nil {
+			fragmentDomains[f.SeqNum] = make(map[string]int)
+		}
+		fragmentDomains[f.SeqNum][domainOf(f.ServerID)]++
+	}
+
+	seqNums := make([]int, 0, len(fragmentDomains))
+	for seqNum := range fragmentDomains {
+		seqNums = append(seqNums, seqNum)
+	}
+	sort.Ints(seqNums)
+
+	for _, seqNum := range seqNums {
+		if domains := fragmentDomains[seqNum]; len(domains) == 1 {
+			for domain, count := range domains {
+				if count == 1 {
+					if singleReplicaAllowed {
+						continue
+					}
+					reasons = append(reasons, fmt.Sprintf("fragment %d has a single replica, in %s", seqNum, domain))
+				} else {
+					reasons = append(reasons, fmt.Sprintf("fragment %d has all %d replicas in %s", seqNum, count, domain))
+				}
+			}
+		}
+	}
+
+	return reasons
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
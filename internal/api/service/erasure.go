@@ -0,0 +1,323 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/reedsolomon"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+// erasureBlockSize is the amount of every shard processed at once when computing parity
+// or restoring a missing shard, bounding memory to (DataShards+ParityShards)*erasureBlockSize.
+const erasureBlockSize = 1 << 20
+
+// storeErasureCoded spools the object as data shards, computes parity shards from them and stores
+// every shard on a distinct server. Data shards are uploaded while the next ones are read,
+// with at most Config.UploadParallelism shards in flight. Stored shards are recorded in the upload journal.
+func (m *ObjectManager) storeErasureCoded(
+	ctx context.Context, pending model.PendingUpload, servers []model.Server, src io.Reader,
+) ([]model.ObjectFragmentMeta, error) {
+	objectName, size := pending.ObjectName, pending.Size
+
+	dataShards, parityShards := m.cfg.DataShards, m.cfg.ParityShards
+	placement, spares, err := m.placeFragments(objectName, servers, dataShards+parityShards, 1, true)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := reedsolomon.New(dataShards, parityShards)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create erasure encoder: %w", err)
+	}
+
+	shardSize := (size + int64(dataShards) - 1) / int64(dataShards)
+
+	// Data shards are kept until parity is computed, so they are released only once all uploads are done.
+	spools := make([]*spool, dataShards+parityShards)
+	defer func() {
+		for _, s := range spools {
+			if s != nil {
+				closeSpool(s)
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(m.cfg.UploadParallelism)
+
+	// Every shard is on a distinct server, so servers failing to store one are replaced by those not used yet.
+	assigned := slices.Concat(placement...)
+	pool := newServerPool(spares, true)
+
+	fragments := make([]model.ObjectFragmentMeta, len(spools))
+	upload := func(i int) {
+		g.Go(func() error {
+			fragmentID := uuid.New()
+
+			placed := m.journalFragment(pending.ID, i, fragmentID, shardSize)
+			checksum, err := m.storeReplicas(gctx, assigned[i:i+1], pool, fragmentID, spools[i], placed)
+			if err != nil {
+				return fmt.Errorf("failed to store shard %d: %w", i, err)
+			}
+
+			fragments[i] = model.ObjectFragmentMeta{
+				SeqNum:       i,
+				ServerID:     assigned[i].ID,
+				FragmentID:   fragmentID,
+				FragmentSize: shardSize,
+				Checksum:     checksum,
+			}
+			return nil
+		})
+	}
+
+	for i := 0; i < dataShards && gctx.Err() == nil; i++ {
+		dataSize := min(max(size-int64(i)*shardSize, 0), shardSize)
+
+		spools[i], err = spoolFragment(m.cfg.SpoolDir, src, dataSize)
+		if err == nil {
+			_, err = io.CopyN(spools[i], zeroReader{}, shardSize-dataSize)
+		}
+		if err != nil {
+			cancel()
+			return nil, errors.Join(fmt.Errorf("failed to spool shard %d: %w", i, err), g.Wait())
+		}
+
+		upload(i)
+	}
+
+	if gctx.Err() == nil {
+		for i := dataShards; i < len(spools); i++ {
+			if spools[i], err = newSpool(m.cfg.SpoolDir); err != nil {
+				cancel()
+				return nil, errors.Join(err, g.Wait())
+			}
+		}
+
+		if err := encodeParity(enc, spools, dataShards, shardSize); err != nil {
+			cancel()
+			return nil, errors.Join(err, g.Wait())
+		}
+
+		for i := dataShards; i < len(spools); i++ {
+			upload(i)
+		}
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return fragments, nil
+}
+
+// encodeParity reads data shards from the first dataShards spools block by block
+// and appends the matching parity blocks to the remaining spools.
+func encodeParity(enc reedsolomon.Encoder, spools []*spool, dataShards int, shardSize int64) error {
+	buffers := make([][]byte, len(spools))
+	for i := range buffers {
+		buffers[i] = make([]byte, erasureBlockSize)
+	}
+
+	shards := make([][]byte, len(spools))
+	for offset := int64(0); offset < shardSize; offset += erasureBlockSize {
+		n := min(erasureBlockSize, shardSize-offset)
+		for i := range shards {
+			shards[i] = buffers[i][:n]
+		}
+
+		for i := 0; i < dataShards; i++ {
+			if _, err := spools[i].ReadAt(shards[i], offset); err != nil {
+				return fmt.Errorf("failed to read shard %d: %w", i, err)
+			}
+		}
+
+		if err := enc.Encode(shards); err != nil {
+			return fmt.Errorf("failed to encode parity: %w", err)
+		}
+
+		for i := dataShards; i < len(spools); i++ {
+			if _, err := spools[i].Write(shards[i]); err != nil {
+				return fmt.Errorf("failed to spool parity shard %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// retrieveErasureCoded writes length bytes of the object starting at offset to dst, reading data shards
+// directly and restoring the parts of those that can't be read from the other shards.
+func (m *ObjectManager) retrieveErasureCoded(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, meta model.ObjectMeta,
+	offset, length int64, dst io.Writer,
+) error {
+	groups := meta.ReplicaGroups()
+	if len(groups) != meta.Layout.DataShards+meta.Layout.ParityShards {
+		return fmt.Errorf("object '%s' has %d of %d shards: %w", meta.ObjectName,
+			len(groups), meta.Layout.DataShards+meta.Layout.ParityShards, model.ErrNotEnoughShards)
+	}
+
+	shards := make([]model.ObjectFragmentMeta, 0, len(groups))
+	for _, g := range groups {
+		shards = append(shards, g[0])
+	}
+	shardSize := shards[0].FragmentSize
+
+	end := offset + length
+	var ranges []fragmentRange
+	for i := 0; i < meta.Layout.DataShards; i++ {
+		shardStart := int64(i) * shardSize
+		shardEnd := min(shardStart+shardSize, meta.Size)
+		if shardEnd <= offset || shardStart >= end {
+			continue
+		}
+
+		shardOffset := max(offset-shardStart, 0)
+		ranges = append(ranges, fragmentRange{
+			seqNum:   i,
+			replicas: shards[i : i+1],
+			offset:   shardOffset,
+			length:   min(end, shardEnd) - shardStart - shardOffset,
+		})
+	}
+
+	return m.retrievePipelined(ctx, ranges, func(ctx context.Context, r fragmentRange, dst io.Writer) error {
+		counter := &countingWriter{dst: dst}
+		err := m.retrieveReplicas(ctx, serversByID, r.replicas, r.offset, r.length, counter)
+		if err == nil {
+			return nil
+		}
+		if counter.n == r.length {
+			// Everything was sent already, but failed verification.
+			return fmt.Errorf("failed to retrieve shard %d: %w", r.seqNum, err)
+		}
+
+		slog.Warn("Restoring shard from other shards", "object", meta.ObjectName, "shard", r.seqNum, "err", err)
+
+		restoreOffset, remaining := r.offset+counter.n, r.length-counter.n
+		err = m.restoreShard(ctx, serversByID, meta.Layout, shards, r.seqNum, nil, restoreOffset, remaining, dst)
+		if err != nil {
+			return fmt.Errorf("failed to restore shard %d: %w", r.seqNum, err)
+		}
+		return nil
+	}, dst)
+}
+
+// restoreShard writes length bytes of the shard with the given index starting at offset to dst,
+// computing them from the same byte ranges of other shards. Shards in lost are not read.
+func (m *ObjectManager) restoreShard(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, layout model.Layout,
+	shards []model.ObjectFragmentMeta, index int, lost map[int]bool, offset, length int64, dst io.Writer,
+) error {
+	enc, err := reedsolomon.New(layout.DataShards, layout.ParityShards)
+	if err != nil {
+		return fmt.Errorf("failed to create erasure decoder: %w", err)
+	}
+
+	unavailable := maps.Clone(lost)
+	if unavailable == nil {
+		unavailable = make(map[int]bool)
+	}
+	unavailable[index] = true
+	for pos := offset; pos < offset+length; pos += erasureBlockSize {
+		n := min(erasureBlockSize, offset+length-pos)
+
+		blocks, err := m.fetchShardBlocks(ctx, serversByID, shards, unavailable, layout.DataShards, pos, n)
+		if err != nil {
+			return err
+		}
+
+		reconstruct := enc.ReconstructData
+		if index >= layout.DataShards {
+			reconstruct = enc.Reconstruct
+		}
+		if err := reconstruct(blocks); err != nil {
+			return fmt.Errorf("failed to reconstruct data: %w", err)
+		}
+
+		if _, err := dst.Write(blocks[index]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchShardBlocks reads the same byte range of count available shards in parallel.
+// Shards failing to serve it are marked unavailable and replaced by others.
+func (m *ObjectManager) fetchShardBlocks(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, shards []model.ObjectFragmentMeta,
+	unavailable map[int]bool, count int, offset, length int64,
+) ([][]byte, error) {
+	blocks := make([][]byte, len(shards))
+
+	for fetched := 0; fetched < count; {
+		var candidates []int
+		for i := range shards {
+			if len(candidates) == count-fetched {
+				break
+			}
+			if !unavailable[i] && blocks[i] == nil {
+				candidates = append(candidates, i)
+			}
+		}
+		if len(candidates) < count-fetched {
+			return nil, fmt.Errorf("%d shards available, %d required: %w",
+				fetched+len(candidates), count, model.ErrNotEnoughShards)
+		}
+
+		errs := make([]error, len(candidates))
+		bufs := make([]bytes.Buffer, len(candidates))
+		var wg sync.WaitGroup
+		for c, i := range candidates {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				server, ok := serversByID[shards[i].ServerID]
+				if !ok {
+					errs[c] = fmt.Errorf("server '%s' not found: %w", shards[i].ServerID, model.ErrServerNotFound)
+					return
+				}
+
+				errs[c] = m.retry(ctx, "retrieve", server.Addr, func(ctx context.Context) error {
+					bufs[c].Reset()
+					bufs[c].Grow(int(length))
+					err := m.objectStorage.Retrieve(ctx, server.Addr, shards[i].FragmentID, offset, length, &bufs[c])
+					if err == nil && int64(bufs[c].Len()) != length {
+						err = fmt.Errorf("got %d bytes of %d: %w", bufs[c].Len(), length, io.ErrUnexpectedEOF)
+					}
+					return err
+				})
+			}()
+		}
+		wg.Wait()
+
+		for c, i := range candidates {
+			if errs[c] != nil {
+				slog.Warn("Failed to retrieve shard block", "fragment_id", shards[i].FragmentID, "err", errs[c])
+				unavailable[i] = true
+				continue
+			}
+			blocks[i] = bufs[c].Bytes()
+			fetched++
+		}
+	}
+
+	return blocks, nil
+}
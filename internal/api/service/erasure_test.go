@@ -0,0 +1,199 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+func newErasureTestManager(t *testing.T) (*ObjectManager, *memStorage) {
+	t.Helper()
+
+	m, storage, _ := newTestObjectManager(Config{
+		Layout:       model.LayoutErasure,
+		DataShards:   4,
+		ParityShards: 2,
+	}, newTestServers(6))
+	return m, storage
+}
+
+func storeTestObject(t *testing.T, m *ObjectManager, data []byte) model.ObjectMeta {
+	t.Helper()
+
+	meta, err := m.StoreObject(context.Background(), "object", bytes.NewReader(data), int64(len(data)),
+		model.ContentDigests{})
+	if err != nil {
+		t.Fatalf("StoreObject() error = %v", err)
+	}
+	return meta
+}
+
+func retrieveTestObject(m *ObjectManager, meta model.ObjectMeta, offset, length int64) ([]byte, error) {
+	var buf bytes.Buffer
+	err := m.RetrieveObject(context.Background(), meta, offset, length, &buf)
+	return buf.Bytes(), err
+}
+
+func TestErasureRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, 3, 4, 1000, 10_001, 4*erasureBlockSize + 5} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			m, storage := newErasureTestManager(t)
+			data := testData(size)
+
+			meta := storeTestObject(t, m, data)
+
+			if len(meta.Fragments) != 6 {
+				t.Fatalf("stored %d shards, want 6", len(meta.Fragments))
+			}
+			shardSize := int64((size + 3) / 4)
+			for _, f := range meta.Fragments {
+				if f.FragmentSize != shardSize {
+					t.Errorf("shard %d has %d bytes, want %d", f.SeqNum, f.FragmentSize, shardSize)
+				}
+				if got := int64(len(storage.fragments[f.FragmentID])); got != shardSize {
+					t.Errorf("shard %d stored with %d bytes, want %d", f.SeqNum, got, shardSize)
+				}
+			}
+
+			got, err := retrieveTestObject(m, meta, 0, int64(size))
+			if err != nil {
+				t.Fatalf("RetrieveObject() error = %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("RetrieveObject() returned %d bytes different from the %d stored", len(got), size)
+			}
+		})
+	}
+}
+
+func TestErasurePaddingTrimmed(t *testing.T) {
+	m, storage := newErasureTestManager(t)
+	data := testData(10_001)
+
+	meta := storeTestObject(t, m, data)
+
+	// 10001 bytes make shards of 2501 bytes, the last data shard holding 2498 bytes and 3 bytes of padding.
+	last := meta.ReplicaGroups()[3][0]
+	want := append(bytes.Clone(data[3*2501:]), 0, 0, 0)
+	if stored := storage.fragments[last.FragmentID]; !bytes.Equal(stored, want) {
+		t.Errorf("last data shard isn't the end of the object padded with zeros")
+	}
+
+	for _, r := range []struct{ offset, length int64 }{
+		{offset: 0, length: 10_001},
+		{offset: 7500, length: 2501},
+		{offset: 10_000, length: 1},
+	} {
+		got, err := retrieveTestObject(m, meta, r.offset, r.length)
+		if err != nil {
+			t.Fatalf("RetrieveObject(%d, %d) error = %v", r.offset, r.length, err)
+		}
+		if !bytes.Equal(got, data[r.offset:r.offset+r.length]) {
+			t.Errorf("RetrieveObject(%d, %d) returned %d different bytes", r.offset, r.length, len(got))
+		}
+	}
+}
+
+func TestErasureMissingShards(t *testing.T) {
+	data := testData(10_001)
+
+	var lostSets [][]int
+	for i := range 6 {
+		lostSets = append(lostSets, []int{i})
+		for j := i + 1; j < 6; j++ {
+			lostSets = append(lostSets, []int{i, j})
+		}
+	}
+
+	for _, lost := range lostSets {
+		t.Run(fmt.Sprint(lost), func(t *testing.T) {
+			m, storage := newErasureTestManager(t)
+			meta := storeTestObject(t, m, data)
+
+			groups := meta.ReplicaGroups()
+			for _, i := range lost {
+				storage.lose(groups[i][0].FragmentID)
+			}
+
+			for _, r := range []struct{ offset, length int64 }{
+				{offset: 0, length: 10_001},
+				{offset: 2000, length: 5000},
+				{offset: 9999, length: 2},
+			} {
+				got, err := retrieveTestObject(m, meta, r.offset, r.length)
+				if err != nil {
+					t.Fatalf("RetrieveObject(%d, %d) error = %v", r.offset, r.length, err)
+				}
+				if !bytes.Equal(got, data[r.offset:r.offset+r.length]) {
+					t.Errorf("RetrieveObject(%d, %d) returned %d different bytes", r.offset, r.length, len(got))
+				}
+			}
+		})
+	}
+}
+
+func TestErasureTooManyShardsMissing(t *testing.T) {
+	m, storage := newErasureTestManager(t)
+	meta := storeTestObject(t, m, testData(10_001))
+
+	groups := meta.ReplicaGroups()
+	for _, i := range []int{0, 4, 5} {
+		storage.lose(groups[i][0].FragmentID)
+	}
+
+	_, err := retrieveTestObject(m, meta, 0, 10_001)
+	if !errors.Is(err, model.ErrNotEnoughShards) {
+		t.Errorf("RetrieveObject() error = %v, want %v", err, model.ErrNotEnoughShards)
+	}
+}
+
+func TestErasureCorruptShardRestored(t *testing.T) {
+	m, storage := newErasureTestManager(t)
+	data := testData(10_001)
+	meta := storeTestObject(t, m, data)
+
+	storage.corrupt(meta.ReplicaGroups()[1][0].FragmentID)
+
+	got, err := retrieveTestObject(m, meta, 0, 10_001)
+	if err != nil {
+		t.Fatalf("RetrieveObject() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("RetrieveObject() returned different bytes")
+	}
+}
+
+func TestRestoreShard(t *testing.T) {
+	m, storage := newErasureTestManager(t)
+	meta := storeTestObject(t, m, testData(4*erasureBlockSize+5))
+
+	serversByID, err := m.getServersByID(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := meta.ReplicaGroups()
+	shards := make([]model.ObjectFragmentMeta, 0, len(groups))
+	for _, g := range groups {
+		shards = append(shards, g[0])
+	}
+	shardSize := shards[0].FragmentSize
+
+	// Every shard, data or parity, is restored from the others, with another one lost too.
+	for index := range shards {
+		lost := map[int]bool{(index + 1) % len(shards): true}
+
+		var buf bytes.Buffer
+		err := m.restoreShard(context.Background(), serversByID, meta.Layout, shards, index, lost, 0, shardSize, &buf)
+		if err != nil {
+			t.Fatalf("restoreShard(%d) error = %v", index, err)
+		}
+		if !bytes.Equal(buf.Bytes(), storage.fragments[shards[index].FragmentID]) {
+			t.Errorf("restoreShard(%d) returned different bytes than stored", index)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+var errFragmentLost = errors.New("fragment lost")
+
+// memStorage keeps fragments in memory, by fragment ID, regardless of the server they are stored on.
+type memStorage struct {
+	mu        sync.Mutex
+	fragments map[uuid.UUID][]byte
+	lost      map[uuid.UUID]bool
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{
+		fragments: make(map[uuid.UUID][]byte),
+		lost:      make(map[uuid.UUID]bool),
+	}
+}
+
+func (s *memStorage) Store(
+	_ context.Context, _ string, objectID uuid.UUID, data io.Reader, size int64,
+) (string, error) {
+	buf, err := io.ReadAll(data)
+	if err != nil {
+		return "", err
+	}
+	if int64(len(buf)) != size {
+		return "", fmt.Errorf("got %d bytes of %d: %w", len(buf), size, io.ErrUnexpectedEOF)
+	}
+
+	s.mu.Lock()
+	s.fragments[objectID] = buf
+	s.mu.Unlock()
+
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (s *memStorage) Retrieve(
+	_ context.Context, _ string, objectID uuid.UUID, offset, length int64, dst io.Writer,
+) error {
+	s.mu.Lock()
+	data, ok := s.fragments[objectID]
+	lost := s.lost[objectID]
+	s.mu.Unlock()
+
+	if !ok || lost {
+		return errFragmentLost
+	}
+	if length == 0 {
+		length = int64(len(data)) - offset
+	}
+	if offset+length > int64(len(data)) {
+		return model.ErrInvalidRange
+	}
+
+	_, err := dst.Write(data[offset : offset+length])
+	return err
+}
+
+func (s *memStorage) Delete(_ context.Context, _ string, objectID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.fragments, objectID)
+	return nil
+}
+
+// lose makes the fragment fail to be retrieved.
+func (s *memStorage) lose(fragmentID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lost[fragmentID] = true
+}
+
+// corrupt flips a byte of the fragment.
+func (s *memStorage) corrupt(fragmentID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := bytes.Clone(s.fragments[fragmentID])
+	data[len(data)/2] ^= 0xff
+	s.fragments[fragmentID] = data
+}
+
+// memRepo keeps object metadata and pending uploads in memory.
+type memRepo struct {
+	mu      sync.Mutex
+	servers []model.Server
+	objects map[string]model.ObjectMeta
+	pending map[uuid.UUID]model.PendingUpload
+}
+
+func newMemRepo(servers []model.Server) *memRepo {
+	return &memRepo{
+		servers: servers,
+		objects: make(map[string]model.ObjectMeta),
+		pending: make(map[uuid.UUID]model.PendingUpload),
+	}
+}
+
+func (r *memRepo) GetObjectMeta(_ context.Context, objectName string) (model.ObjectMeta, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	meta, ok := r.objects[objectName]
+	if !ok {
+		return model.ObjectMeta{}, model.ErrObjectNotFound
+	}
+	return meta, nil
+}
+
+func (r *memRepo) DeleteObjectMeta(_ context.Context, objectName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.objects[objectName]; !ok {
+		return model.ErrObjectNotFound
+	}
+	delete(r.objects, objectName)
+	return nil
+}
+
+func (r *memRepo) GetServers(_ context.Context) ([]model.Server, error) {
+	return r.servers, nil
+}
+
+func (r *memRepo) CreatePendingUpload(_ context.Context, upload model.PendingUpload) (model.PendingUpload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upload.ID = uuid.New()
+	r.pending[upload.ID] = upload
+	return upload, nil
+}
+
+func (r *memRepo) AddPendingFragments(
+	_ context.Context, uploadID uuid.UUID, fragments []model.ObjectFragmentMeta,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upload, ok := r.pending[uploadID]
+	if !ok {
+		return model.ErrUploadAbandoned
+	}
+	upload.Fragments = append(upload.Fragments, fragments...)
+	r.pending[uploadID] = upload
+	return nil
+}
+
+func (r *memRepo) TouchPendingUpload(_ context.Context, uploadID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.pending[uploadID]; !ok {
+		return model.ErrUploadAbandoned
+	}
+	return nil
+}
+
+func (r *memRepo) CommitUpload(_ context.Context, uploadID uuid.UUID, meta model.ObjectMeta) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.pending[uploadID]; !ok {
+		return model.ErrUploadAbandoned
+	}
+	delete(r.pending, uploadID)
+	r.objects[meta.ObjectName] = meta
+	return nil
+}
+
+func (r *memRepo) DeletePendingUpload(_ context.Context, uploadID uuid.UUID) (model.PendingUpload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upload, ok := r.pending[uploadID]
+	if !ok {
+		return model.PendingUpload{}, model.ErrUploadAbandoned
+	}
+	delete(r.pending, uploadID)
+	return upload, nil
+}
+
+func (r *memRepo) IsFragmentReferenced(_ context.Context, serverID, fragmentID uuid.UUID) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, meta := range r.objects {
+		for _, f := range meta.Fragments {
+			if f.ServerID == serverID && f.FragmentID == fragmentID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// staticHealth reports the given state for servers listed in it, and up for the others.
+type staticHealth map[uuid.UUID]model.HealthState
+
+func (h staticHealth) State(serverID uuid.UUID) model.HealthState {
+	if state, ok := h[serverID]; ok {
+		return state
+	}
+	return model.HealthUp
+}
+
+// newTestServers returns count servers with the same capacity, spread over the racks round-robin.
+// Servers get no labels without racks.
+func newTestServers(count int, racks ...string) []model.Server {
+	servers := make([]model.Server, 0, count)
+	for i := range count {
+		s := model.Server{
+			ID:       uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("server-%d", i))),
+			Addr:     fmt.Sprintf("storage%d:50051", i),
+			Capacity: 1 << 30,
+		}
+		if len(racks) > 0 {
+			s.Labels = map[string]string{model.LabelRack: racks[i%len(racks)]}
+		}
+		servers = append(servers, s)
+	}
+	return servers
+}
+
+func newTestObjectManager(cfg Config, servers []model.Server) (*ObjectManager, *memStorage, *memRepo) {
+	storage := newMemStorage()
+	repo := newMemRepo(servers)
+	cfg.Retry.MaxAttempts = 1
+	return NewObjectManager(storage, repo, staticHealth{}, cfg), storage, repo
+}
+
+// testData returns size bytes of a repeating, position dependent pattern.
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i*7 + i/251)
+	}
+	return data
+}
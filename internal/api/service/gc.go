@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+const (
+	defaultGCInterval    = 6 * time.Hour
+	defaultGCGracePeriod = 24 * time.Hour
+
+	// maxReportedOrphans bounds the number of orphaned fragments listed per server in a report.
+	maxReportedOrphans = 1000
+
+	// gcLockKey is the advisory lock key letting a single API server collect garbage at a time.
+	gcLockKey int64 = 0x5353_0003
+)
+
+type fragmentInventory interface {
+	objectStorage
+	ListFragments(ctx context.Context, serverAddr string, fn func(entry model.FragmentEntry) error) error
+}
+
+type gcRepository interface {
+	GetServers(ctx context.Context) ([]model.Server, error)
+	ListReferencedFragments(ctx context.Context, serverID uuid.UUID) ([]uuid.UUID, error)
+	IsFragmentReferencedAnywhere(ctx context.Context, fragmentID uuid.UUID) (bool, error)
+	TryLock(ctx context.Context, key int64) (func(), bool, error)
+}
+
+type GCConfig struct {
+	// Interval is the period of garbage collection passes.
+	Interval time.Duration
+	// GracePeriod is how old an unreferenced fragment has to be to be deleted. It must be longer than
+	// any upload takes, since fragments are written before the object metadata referencing them.
+	// Servers that joined the cluster within it are not collected either.
+	GracePeriod time.Duration
+	// DryRun makes periodic passes only report orphaned fragments instead of deleting them.
+	DryRun bool
+}
+
+func (cfg *GCConfig) SetDefaults() {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultGCInterval
+	}
+	if cfg.GracePeriod <= 0 {
+		cfg.GracePeriod = defaultGCGracePeriod
+	}
+}
+
+// GarbageCollector deletes fragments no object references from storage servers,
+// such as those left behind by uploads that failed midway.
+type GarbageCollector struct {
+	storage fragmentInventory
+	repo    gcRepository
+	health  serverHealth
+	cfg     GCConfig
+
+	mu         sync.Mutex
+	lastReport *model.GCReport
+}
+
+func NewGarbageCollector(
+	storage fragmentInventory, repo gcRepository, health serverHealth, cfg GCConfig,
+) *GarbageCollector {
+	cfg.SetDefaults()
+
+	return &GarbageCollector{
+		storage: storage,
+		repo:    repo,
+		health:  health,
+		cfg:     cfg,
+	}
+}
+
+// Run collects garbage every Interval until the context is canceled.
+func (g *GarbageCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_, err := g.Collect(ctx, g.cfg.DryRun)
+		if err != nil && !errors.Is(err, model.ErrGCRunning) && ctx.Err() == nil {
+			slog.Error("Garbage collection failed", "err", err)
+		}
+	}
+}
+
+// Collect lists the fragments of every server and deletes those nothing references, unless dryRun is set.
+// It fails with model.ErrGCRunning if another collection is in progress, on this API server or another one.
+func (g *GarbageCollector) Collect(ctx context.Context, dryRun bool) (model.GCReport, error) {
+	release, acquired, err := g.repo.TryLock(ctx, gcLockKey)
+	if err != nil {
+		return model.GCReport{}, fmt.Errorf("failed to take garbage collector lock: %w", err)
+	}
+	if !acquired {
+		return model.GCReport{}, model.ErrGCRunning
+	}
+	defer release()
+
+	servers, err := g.repo.GetServers(ctx)
+	if err != nil {
+		return model.GCReport{}, fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	report := model.GCReport{
+		DryRun:    dryRun,
+		StartedAt: time.Now(),
+		Servers:   make([]model.ServerGCReport, 0, len(servers)),
+	}
+	modifiedBefore := report.StartedAt.Add(-g.cfg.GracePeriod)
+
+	for _, server := range servers {
+		if err := ctx.Err(); err != nil {
+			return model.GCReport{}, err
+		}
+
+		serverReport := g.collectServer(ctx, server, modifiedBefore, dryRun)
+		if serverReport.Error != "" {
+			slog.Warn("Garbage collection of server incomplete", "server_id", server.ID, "addr", server.Addr,
+				"err", serverReport.Error)
+		}
+		report.Servers = append(report.Servers, serverReport)
+	}
+	report.FinishedAt = time.Now()
+
+	var orphans, deleted int64
+	for _, s := range report.Servers {
+		orphans += s.OrphanCount
+		deleted += s.Deleted
+	}
+	slog.Info("Garbage collection finished", "dry_run", dryRun, "orphans", orphans, "deleted", deleted,
+		"duration", report.FinishedAt.Sub(report.StartedAt))
+
+	g.mu.Lock()
+	g.lastReport = &report
+	g.mu.Unlock()
+
+	return report, nil
+}
+
+// LastReport returns the report of the latest collection run by this API server, false if there was none.
+func (g *GarbageCollector) LastReport() (model.GCReport, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.lastReport == nil {
+		return model.GCReport{}, false
+	}
+
+	return *g.lastReport, true
+}
+
+// collectServer finds the fragments on the server modified before the given time that nothing references,
+// and deletes them unless dryRun is set.
+func (g *GarbageCollector) collectServer(
+	ctx context.Context, server model.Server, modifiedBefore time.Time, dryRun bool,
+) model.ServerGCReport {
+	report := model.ServerGCReport{Server: server}
+
+	if server.Stale || g.health.State(server.ID) == model.HealthDown {
+		report.Error = "server unavailable"
+		return report
+	}
+	// A server that just joined may hold fragments the metadata knows under another server ID,
+	// such as after losing its ID file, so its fragments get a grace period to be sorted out.
+	if server.FirstHeartbeatAt.IsZero() || server.FirstHeartbeatAt.After(modifiedBefore) {
+		report.Error = "server joined within the grace period"
+		return report
+	}
+
+	// Fragments are listed before their references are loaded, so those of an object stored meanwhile
+	// are seen referenced.
+	var candidates []model.FragmentEntry
+	err := g.storage.ListFragments(ctx, server.Addr, func(entry model.FragmentEntry) error {
+		report.Fragments++
+		if entry.ModTime.Before(modifiedBefore) {
+			candidates = append(candidates, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		report.Error = fmt.Sprintf("failed to list fragments: %v", err)
+		return report
+	}
+
+	fragmentIDs, err := g.repo.ListReferencedFragments(ctx, server.ID)
+	if err != nil {
+		report.Error = fmt.Sprintf("failed to list referenced fragments: %v", err)
+		return report
+	}
+
+	referenced := make(map[uuid.UUID]bool, len(fragmentIDs))
+	for _, id := range fragmentIDs {
+		referenced[id] = true
+	}
+
+	for _, entry := range candidates {
+		if referenced[entry.FragmentID] {
+			continue
+		}
+
+		// Fragment IDs are unique, so a fragment referenced on another server is a copy of a live one,
+		// left by a server that registered again under a new ID, not garbage.
+		elsewhere, err := g.repo.IsFragmentReferencedAnywhere(ctx, entry.FragmentID)
+		if err != nil {
+			report.Error = fmt.Sprintf("failed to check fragment %s references: %v", entry.FragmentID, err)
+			continue
+		}
+		if elsewhere {
+			slog.Warn("Fragment referenced on another server, keeping it", "server_id", server.ID,
+				"fragment_id", entry.FragmentID)
+			continue
+		}
+
+		report.OrphanCount++
+		report.OrphanBytes += entry.Size
+		if len(report.Orphans) < maxReportedOrphans {
+			report.Orphans = append(report.Orphans, entry)
+		}
+		if dryRun {
+			continue
+		}
+
+		deleted, err := g.deleteOrphan(ctx, server, entry.FragmentID)
+		if err != nil {
+			report.Error = fmt.Sprintf("failed to delete fragment %s: %v", entry.FragmentID, err)
+			continue
+		}
+		if deleted {
+			report.Deleted++
+		}
+	}
+
+	return report
+}
+
+// deleteOrphan deletes the fragment from the server unless something got to reference it meanwhile,
+// on any server, and reports whether it did.
+func (g *GarbageCollector) deleteOrphan(
+	ctx context.Context, server model.Server, fragmentID uuid.UUID,
+) (bool, error) {
+	referenced, err := g.repo.IsFragmentReferencedAnywhere(ctx, fragmentID)
+	if err != nil {
+		return false, err
+	}
+	if referenced {
+		return false, nil
+	}
+
+	if err := g.storage.Delete(ctx, server.Addr, fragmentID); err != nil {
+		return false, err
+	}
+
+	slog.Info("Orphaned fragment deleted", "server_id", server.ID, "fragment_id", fragmentID)
+	orphansDeleted.Add(1)
+
+	return true, nil
+}
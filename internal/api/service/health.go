@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+const (
+	defaultHealthInterval        = 5 * time.Second
+	defaultHealthTimeout         = 2 * time.Second
+	defaultHealthFallThreshold   = 3
+	defaultHealthRiseThreshold   = 2
+	defaultHealthDegradedLatency = 500 * time.Millisecond
+)
+
+type healthProber interface {
+	CheckHealth(ctx context.Context, serverAddr string) error
+}
+
+type serverRepository interface {
+	GetServers(ctx context.Context) ([]model.Server, error)
+}
+
+type HealthConfig struct {
+	// Interval is the period of probing every server.
+	Interval time.Duration
+	// Timeout bounds a single probe.
+	Timeout time.Duration
+	// FallThreshold is the number of consecutive failed probes marking a server down.
+	// A single failed probe marks it degraded.
+	FallThreshold int
+	// RiseThreshold is the number of consecutive successful probes bringing a server back:
+	// a down server becomes degraded, a degraded one becomes up.
+	RiseThreshold int
+	// DegradedLatency is the probe latency above which a server is degraded.
+	DegradedLatency time.Duration
+}
+
+func (cfg *HealthConfig) SetDefaults() {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultHealthInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultHealthTimeout
+	}
+	if cfg.FallThreshold <= 0 {
+		cfg.FallThreshold = defaultHealthFallThreshold
+	}
+	if cfg.RiseThreshold <= 0 {
+		cfg.RiseThreshold = defaultHealthRiseThreshold
+	}
+	if cfg.DegradedLatency <= 0 {
+		cfg.DegradedLatency = defaultHealthDegradedLatency
+	}
+}
+
+// HealthChecker periodically probes storage servers and tracks their health.
+// State changes need several consecutive probes agreeing, so a server doesn't flap on a single blip.
+type HealthChecker struct {
+	prober   healthProber
+	repo     serverRepository
+	cfg      HealthConfig
+	mu       sync.RWMutex
+	statuses map[uuid.UUID]*serverStatus
+}
+
+type serverStatus struct {
+	health model.ServerHealth
+	// fastSuccesses counts the latest successful probes answered within HealthConfig.DegradedLatency.
+	fastSuccesses int
+}
+
+func NewHealthChecker(prober healthProber, repo serverRepository, cfg HealthConfig) *HealthChecker {
+	cfg.SetDefaults()
+
+	return &HealthChecker{
+		prober:   prober,
+		repo:     repo,
+		cfg:      cfg,
+		statuses: make(map[uuid.UUID]*serverStatus),
+	}
+}
+
+// Run probes servers until the context is canceled.
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		h.probeAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *HealthChecker) probeAll(ctx context.Context) {
+	servers, err := h.repo.GetServers(ctx)
+	if err != nil {
+		slog.Error("Failed to get servers for health check", "err", err)
+		return
+	}
+
+	h.mu.Lock()
+	known := make(map[uuid.UUID]*serverStatus, len(servers))
+	for _, s := range servers {
+		status, ok := h.statuses[s.ID]
+		if !ok {
+			status = &serverStatus{health: model.ServerHealth{State: model.HealthUnknown, Since: time.Now()}}
+		}
+		status.health.Server = s
+		known[s.ID] = status
+	}
+	h.statuses = known
+	h.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			probeCtx, cancel := context.WithTimeout(ctx, h.cfg.Timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := h.prober.CheckHealth(probeCtx, s.Addr)
+			if ctx.Err() != nil {
+				return
+			}
+			h.record(s.ID, time.Since(start), err)
+		}()
+	}
+	wg.Wait()
+}
+
+func (h *HealthChecker) record(serverID uuid.UUID, latency time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status, ok := h.statuses[serverID]
+	if !ok {
+		return
+	}
+
+	health := &status.health
+	health.LastCheck = time.Now()
+	health.Latency = latency
+
+	state := health.State
+	if err != nil {
+		health.LastError = err.Error()
+		health.ConsecutiveFailures++
+		health.ConsecutiveSuccesses = 0
+		status.fastSuccesses = 0
+
+		if health.ConsecutiveFailures >= h.cfg.FallThreshold {
+			state = model.HealthDown
+		} else if state != model.HealthDown {
+			state = model.HealthDegraded
+		}
+	} else {
+		health.LastError = ""
+		health.ConsecutiveFailures = 0
+		health.ConsecutiveSuccesses++
+		if latency <= h.cfg.DegradedLatency {
+			status.fastSuccesses++
+		} else {
+			status.fastSuccesses = 0
+		}
+
+		switch {
+		case state == model.HealthDown:
+			if health.ConsecutiveSuccesses >= h.cfg.RiseThreshold {
+				state = model.HealthDegraded
+			}
+		case status.fastSuccesses == 0:
+			state = model.HealthDegraded
+		case state == model.HealthUnknown || status.fastSuccesses >= h.cfg.RiseThreshold:
+			state = model.HealthUp
+		}
+	}
+
+	if state != health.State {
+		slog.Info("Server health changed", "server", health.Server.Addr, "from", health.State, "to", state,
+			"latency", latency, "err", err)
+		health.State = state
+		health.Since = health.LastCheck
+	}
+}
+
+// State returns the health state of the server, unknown for servers not probed yet.
+func (h *HealthChecker) State(serverID uuid.UUID) model.HealthState {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if status, ok := h.statuses[serverID]; ok {
+		return status.health.State
+	}
+	return model.HealthUnknown
+}
+
+// Health returns the health of all known servers ordered by address.
+func (h *HealthChecker) Health() []model.ServerHealth {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	health := make([]model.ServerHealth, 0, len(h.statuses))
+	for _, status := range h.statuses {
+		health = append(health, status.health)
+	}
+
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].Server.Addr < health[j].Server.Addr
+	})
+
+	return health
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+var errProbeFailed = errors.New("probe failed")
+
+// scriptedProber fails the probes of the servers whose address is set in it.
+type scriptedProber struct {
+	mu      sync.Mutex
+	failing map[string]bool
+}
+
+func (p *scriptedProber) CheckHealth(_ context.Context, serverAddr string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failing[serverAddr] {
+		return errProbeFailed
+	}
+	return nil
+}
+
+func newTestHealthChecker(prober healthProber, servers []model.Server) *HealthChecker {
+	return NewHealthChecker(prober, newMemRepo(servers), HealthConfig{
+		FallThreshold:   3,
+		RiseThreshold:   2,
+		DegradedLatency: 100 * time.Millisecond,
+	})
+}
+
+func TestHealthCheckerThresholds(t *testing.T) {
+	type probe struct {
+		fail bool
+		slow bool
+		want model.HealthState
+	}
+	var (
+		ok   = func(want model.HealthState) probe { return probe{want: want} }
+		slow = func(want model.HealthState) probe { return probe{slow: true, want: want} }
+		fail = func(want model.HealthState) probe { return probe{fail: true, want: want} }
+	)
+
+	tests := []struct {
+		name   string
+		probes []probe
+	}{
+		{
+			name:   "first success",
+			probes: []probe{ok(model.HealthUp)},
+		},
+		{
+			name:   "first slow success",
+			probes: []probe{slow(model.HealthDegraded)},
+		},
+		{
+			name:   "first failure",
+			probes: []probe{fail(model.HealthDegraded)},
+		},
+		{
+			name: "falls after consecutive failures",
+			probes: []probe{
+				ok(model.HealthUp),
+				fail(model.HealthDegraded),
+				fail(model.HealthDegraded),
+				fail(model.HealthDown),
+				fail(model.HealthDown),
+			},
+		},
+		{
+			name: "success resets the failures",
+			probes: []probe{
+				ok(model.HealthUp),
+				fail(model.HealthDegraded),
+				fail(model.HealthDegraded),
+				ok(model.HealthDegraded),
+				fail(model.HealthDegraded),
+				fail(model.HealthDegraded),
+				fail(model.HealthDown),
+			},
+		},
+		{
+			name: "rises after consecutive successes",
+			probes: []probe{
+				ok(model.HealthUp),
+				fail(model.HealthDegraded),
+				ok(model.HealthDegraded),
+				ok(model.HealthUp),
+			},
+		},
+		{
+			name: "rises from down through degraded",
+			probes: []probe{
+				fail(model.HealthDegraded),
+				fail(model.HealthDegraded),
+				fail(model.HealthDown),
+				ok(model.HealthDown),
+				ok(model.HealthDegraded),
+				ok(model.HealthUp),
+			},
+		},
+		{
+			name: "failure keeps a rising server down",
+			probes: []probe{
+				fail(model.HealthDegraded),
+				fail(model.HealthDegraded),
+				fail(model.HealthDown),
+				ok(model.HealthDown),
+				fail(model.HealthDown),
+				ok(model.HealthDown),
+				ok(model.HealthDegraded),
+			},
+		},
+		{
+			name: "slow successes degrade",
+			probes: []probe{
+				ok(model.HealthUp),
+				slow(model.HealthDegraded),
+				ok(model.HealthDegraded),
+				slow(model.HealthDegraded),
+				ok(model.HealthDegraded),
+				ok(model.HealthUp),
+			},
+		},
+		{
+			name: "slow successes bring a server up to degraded only",
+			probes: []probe{
+				fail(model.HealthDegraded),
+				fail(model.HealthDegraded),
+				fail(model.HealthDown),
+				slow(model.HealthDown),
+				slow(model.HealthDegraded),
+				slow(model.HealthDegraded),
+				ok(model.HealthDegraded),
+				ok(model.HealthUp),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServers(1)[0]
+			h := newTestHealthChecker(&scriptedProber{}, []model.Server{server})
+			h.statuses[server.ID] = &serverStatus{health: model.ServerHealth{Server: server, State: model.HealthUnknown}}
+
+			for i, p := range tt.probes {
+				latency := 10 * time.Millisecond
+				if p.slow {
+					latency = time.Second
+				}
+				var err error
+				if p.fail {
+					err = errProbeFailed
+				}
+
+				h.record(server.ID, latency, err)
+
+				if got := h.State(server.ID); got != p.want {
+					t.Fatalf("probe %d: State() = %s, want %s", i, got, p.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthCheckerSinceChangesWithState(t *testing.T) {
+	server := newTestServers(1)[0]
+	h := newTestHealthChecker(&scriptedProber{}, []model.Server{server})
+	h.statuses[server.ID] = &serverStatus{health: model.ServerHealth{Server: server, State: model.HealthUnknown}}
+
+	h.record(server.ID, 0, nil)
+	since := h.Health()[0].Since
+
+	h.record(server.ID, 0, nil)
+	if got := h.Health()[0].Since; !got.Equal(since) {
+		t.Errorf("Since = %v after a probe keeping the state, want %v", got, since)
+	}
+
+	h.record(server.ID, 0, errProbeFailed)
+	health := h.Health()[0]
+	if !health.Since.Equal(health.LastCheck) {
+		t.Errorf("Since = %v after a state change, want the last check %v", health.Since, health.LastCheck)
+	}
+	if health.LastError != errProbeFailed.Error() || health.ConsecutiveFailures != 1 {
+		t.Errorf("LastError = %q, ConsecutiveFailures = %d after a failed probe",
+			health.LastError, health.ConsecutiveFailures)
+	}
+}
+
+func TestHealthCheckerProbeAll(t *testing.T) {
+	servers := newTestServers(3)
+	prober := &scriptedProber{failing: map[string]bool{servers[1].Addr: true}}
+	h := newTestHealthChecker(prober, servers)
+
+	for _, s := range servers {
+		if got := h.State(s.ID); got != model.HealthUnknown {
+			t.Errorf("State(%s) before probing = %s, want %s", s.Addr, got, model.HealthUnknown)
+		}
+	}
+
+	wantStates := [][]model.HealthState{
+		{model.HealthUp, model.HealthDegraded, model.HealthUp},
+		{model.HealthUp, model.HealthDegraded, model.HealthUp},
+		{model.HealthUp, model.HealthDown, model.HealthUp},
+	}
+	for round, want := range wantStates {
+		h.probeAll(context.Background())
+
+		for i, s := range servers {
+			if got := h.State(s.ID); got != want[i] {
+				t.Errorf("round %d: State(%s) = %s, want %s", round, s.Addr, got, want[i])
+			}
+		}
+	}
+
+	// Servers gone from the repository are forgotten.
+	h.repo = newMemRepo(servers[:1])
+	h.probeAll(context.Background())
+
+	if got := len(h.Health()); got != 1 {
+		t.Errorf("Health() returned %d servers, want 1", got)
+	}
+	if got := h.State(servers[1].ID); got != model.HealthUnknown {
+		t.Errorf("State() of a removed server = %s, want %s", got, model.HealthUnknown)
+	}
+	if got := h.State(uuid.New()); got != model.HealthUnknown {
+		t.Errorf("State() of an unknown server = %s, want %s", got, model.HealthUnknown)
+	}
+}
@@ -0,0 +1,16 @@
+package service
+
+import "expvar"
+
+var (
+	// fragmentRetries counts retried fragment transfers by operation.
+	fragmentRetries = expvar.NewMap("fragment_retries")
+	// fragmentFailovers counts fragments stored on another server than the one chosen first.
+	fragmentFailovers = expvar.NewInt("fragment_failovers")
+	// fragmentMoves counts fragment copies moved to another server by reason.
+	fragmentMoves = expvar.NewMap("fragment_moves")
+	// fragmentRepairs counts lost fragment copies rebuilt on another server.
+	fragmentRepairs = expvar.NewInt("fragment_repairs")
+	// orphansDeleted counts fragments deleted by garbage collection because nothing referenced them.
+	orphansDeleted = expvar.NewInt("orphan_fragments_deleted")
+)
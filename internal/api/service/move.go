@@ -0,0 +1,253 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/time/rate"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+	"github.com/ssimpl/simple-storage/internal/pkg/ratelimit"
+)
+
+type fragmentStorage interface {
+	objectStorage
+	Stat(ctx context.Context, serverAddr string, objectID uuid.UUID) (model.FragmentInfo, error)
+}
+
+type moveRepository interface {
+	GetServers(ctx context.Context) ([]model.Server, error)
+	GetFragmentMoves(ctx context.Context) ([]model.FragmentMove, error)
+	UpdateFragmentMove(ctx context.Context, move model.FragmentMove) error
+	DeleteFragmentMove(ctx context.Context, moveID uuid.UUID) error
+	SwitchFragmentServer(ctx context.Context, move model.FragmentMove) error
+	fragmentReferences
+}
+
+// fragmentMover carries out queued fragment moves: it copies the fragment to the target server, verifies the copy,
+// switches object metadata to it and deletes the source copy. Every step is recorded in the queue,
+// so moves interrupted by a restart resume where they stopped.
+type fragmentMover struct {
+	storage fragmentStorage
+	repo    moveRepository
+	limiter *rate.Limiter
+	// maxAttempts is the number of failed attempts after which a move gives up.
+	maxAttempts int
+	// sourceRetention is the time source copies are kept after the switch,
+	// so downloads that read the metadata before it can finish.
+	sourceRetention time.Duration
+}
+
+// newFragmentMover creates a mover copying at most bandwidth bytes per second, without a limit if it is 0.
+func newFragmentMover(
+	storage fragmentStorage, repo moveRepository, bandwidth int64, maxAttempts int, sourceRetention time.Duration,
+) *fragmentMover {
+	return &fragmentMover{
+		storage:         storage,
+		repo:            repo,
+		limiter:         ratelimit.NewLimiter(bandwidth),
+		maxAttempts:     maxAttempts,
+		sourceRetention: sourceRetention,
+	}
+}
+
+// runMoves carries out all unfinished moves one by one until the context is canceled.
+func (mv *fragmentMover) runMoves(ctx context.Context) error {
+	moves, err := mv.repo.GetFragmentMoves(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get fragment moves: %w", err)
+	}
+
+	servers, err := mv.repo.GetServers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	serversByID := make(map[uuid.UUID]model.Server, len(servers))
+	for _, s := range servers {
+		serversByID[s.ID] = s
+	}
+
+	for _, move := range moves {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		switch move.State {
+		case model.MovePending:
+			mv.copyAndSwitch(ctx, serversByID, move)
+		case model.MoveSwitched:
+			if time.Since(move.UpdatedAt) >= mv.sourceRetention {
+				mv.deleteSource(ctx, serversByID, move)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (mv *fragmentMover) copyAndSwitch(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, move model.FragmentMove,
+) {
+	log := slog.With("object", move.ObjectName, "fragment_id", move.FragmentID, "reason", move.Reason,
+		"source", move.SourceServerID, "target", move.TargetServerID)
+
+	target, ok := serversByID[move.TargetServerID]
+	if !ok {
+		log.Warn("Fragment move abandoned, target server removed")
+		mv.deleteMove(ctx, move)
+		return
+	}
+
+	size, err := mv.copyFragment(ctx, serversByID, move, target)
+	if err == nil {
+		move.FragmentSize = size
+		err = mv.repo.SwitchFragmentServer(ctx, move)
+	}
+
+	switch {
+	case err == nil:
+		log.Info("Fragment moved", "size", move.FragmentSize)
+		fragmentMoves.Add(string(move.Reason), 1)
+		return
+	case ctx.Err() != nil:
+		return
+	case errors.Is(err, model.ErrFragmentChanged):
+		// The object was deleted or overwritten meanwhile, so the copy is not needed anymore.
+		log.Info("Fragment move abandoned, object changed")
+		if err := mv.deleteCopy(ctx, target, move.FragmentID); err != nil {
+			log.Warn("Failed to delete fragment copy", "err", err)
+		}
+		mv.deleteMove(ctx, move)
+		return
+	}
+
+	move.Attempts++
+	move.LastError = err.Error()
+	if move.Attempts >= mv.maxAttempts {
+		move.State = model.MoveFailed
+		log.Error("Fragment move failed", "attempts", move.Attempts, "err", err)
+		if err := mv.deleteCopy(ctx, target, move.FragmentID); err != nil {
+			log.Warn("Failed to delete fragment copy", "err", err)
+		}
+	} else {
+		log.Warn("Fragment move attempt failed", "attempts", move.Attempts, "err", err)
+	}
+
+	if err := mv.repo.UpdateFragmentMove(ctx, move); err != nil {
+		log.Error("Failed to save fragment move", "err", err)
+	}
+}
+
+// copyFragment copies the fragment from the source server to the target one, checks that the target server
+// persisted it unchanged and returns its size. The size is taken from the source server, since objects stored
+// before sizes were recorded have them zeroed.
+func (mv *fragmentMover) copyFragment(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, move model.FragmentMove, target model.Server,
+) (int64, error) {
+	source, ok := serversByID[move.SourceServerID]
+	if !ok {
+		return 0, fmt.Errorf("source server %s: %w", move.SourceServerID, model.ErrServerNotFound)
+	}
+
+	sourceInfo, err := mv.storage.Stat(ctx, source.Addr, move.FragmentID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check fragment on '%s': %w", source.Addr, err)
+	}
+	if !sourceInfo.Exists {
+		return 0, fmt.Errorf("fragment on '%s': %w", source.Addr, model.ErrObjectNotFound)
+	}
+	size := sourceInfo.Size
+	if move.FragmentSize != 0 && size != move.FragmentSize {
+		return 0, fmt.Errorf("fragment on '%s' has %d bytes, expected %d: %w",
+			source.Addr, size, move.FragmentSize, model.ErrSizeMismatch)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	go func() {
+		err := mv.storage.Retrieve(ctx, source.Addr, move.FragmentID, 0, size, pw)
+		pw.CloseWithError(err)
+	}()
+
+	checksum, err := mv.storage.Store(ctx, target.Addr, move.FragmentID, ratelimit.NewReader(ctx, pr, mv.limiter), size)
+	_ = pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy fragment from '%s' to '%s': %w", source.Addr, target.Addr, err)
+	}
+
+	expected := cmp.Or(move.Checksum, sourceInfo.Checksum, checksum)
+	if checksum != expected {
+		return 0, fmt.Errorf("copy of fragment from '%s': expected %s, got %s: %w",
+			source.Addr, expected, checksum, model.ErrChecksumMismatch)
+	}
+
+	info, err := mv.storage.Stat(ctx, target.Addr, move.FragmentID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to verify fragment copy on '%s': %w", target.Addr, err)
+	}
+	if !info.Exists || info.Size != size || (info.Checksum != "" && info.Checksum != expected) {
+		return 0, fmt.Errorf("fragment copy on '%s' has %d bytes, checksum %s: %w",
+			target.Addr, info.Size, info.Checksum, model.ErrChecksumMismatch)
+	}
+
+	return size, nil
+}
+
+// deleteSource deletes the source copy of a switched move, unless an object still references it.
+func (mv *fragmentMover) deleteSource(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, move model.FragmentMove,
+) {
+	if source, ok := serversByID[move.SourceServerID]; ok {
+		if err := mv.deleteCopy(ctx, source, move.FragmentID); err != nil {
+			slog.Warn("Failed to delete moved fragment",
+				"fragment_id", move.FragmentID, "server", source.Addr, "err", err)
+			return
+		}
+	}
+
+	mv.deleteMove(ctx, move)
+}
+
+// deleteCopy deletes the fragment from the server, unless an object references it there.
+func (mv *fragmentMover) deleteCopy(ctx context.Context, server model.Server, fragmentID uuid.UUID) error {
+	return deleteUnreferenced(ctx, mv.storage, mv.repo, server, fragmentID)
+}
+
+type fragmentReferences interface {
+	IsFragmentReferenced(ctx context.Context, serverID, fragmentID uuid.UUID) (bool, error)
+}
+
+// deleteUnreferenced deletes a fragment copy left behind by a background job from the server,
+// unless an object references it there.
+func deleteUnreferenced(
+	ctx context.Context, storage objectStorage, refs fragmentReferences, server model.Server, fragmentID uuid.UUID,
+) error {
+	referenced, err := refs.IsFragmentReferenced(ctx, server.ID, fragmentID)
+	if err != nil {
+		return err
+	}
+	if referenced {
+		return nil
+	}
+
+	if err := storage.Delete(ctx, server.Addr, fragmentID); err != nil {
+		return fmt.Errorf("failed to delete fragment: %w", err)
+	}
+
+	return nil
+}
+
+func (mv *fragmentMover) deleteMove(ctx context.Context, move model.FragmentMove) {
+	if err := mv.repo.DeleteFragmentMove(ctx, move.ID); err != nil {
+		slog.Error("Failed to delete fragment move", "move_id", move.ID, "err", err)
+	}
+}
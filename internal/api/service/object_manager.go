@@ -2,133 +2,497 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"slices"
 	"sort"
 
 	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 
 	"github.com/ssimpl/simple-storage/internal/api/model"
 )
 
 type objectStorage interface {
-	Store(ctx context.Context, serverAddr string, objectID uuid.UUID, data io.Reader) error
-	Retrieve(ctx context.Context, serverAddr string, objectID uuid.UUID, dst io.Writer) error
+	Store(ctx context.Context, serverAddr string, objectID uuid.UUID, data io.Reader, size int64) (string, error)
+	Retrieve(ctx context.Context, serverAddr string, objectID uuid.UUID, offset, length int64, dst io.Writer) error
+	Delete(ctx context.Context, serverAddr string, objectID uuid.UUID) error
 }
 
 type metaRepository interface {
-	SaveObjectMeta(ctx context.Context, meta model.ObjectMeta) error
 	GetObjectMeta(ctx context.Context, objectName string) (model.ObjectMeta, error)
+	DeleteObjectMeta(ctx context.Context, objectName string) error
 	GetServers(ctx context.Context) ([]model.Server, error)
+	uploadJournal
+}
+
+type serverHealth interface {
+	State(serverID uuid.UUID) model.HealthState
 }
 
 type ObjectManager struct {
 	objectStorage objectStorage
 	metaRepo      metaRepository
-	fragmentCount int
+	health        serverHealth
+	cfg           Config
+	// prefetchMemory bounds the memory taken by fragments downloaded ahead, shared by all downloads.
+	prefetchMemory *semaphore.Weighted
 }
 
 func NewObjectManager(
-	objectStorage objectStorage, metaRepo metaRepository, fragmentCount int,
+	objectStorage objectStorage, metaRepo metaRepository, health serverHealth, cfg Config,
 ) *ObjectManager {
+	cfg.SetDefaults()
+
 	return &ObjectManager{
-		objectStorage: objectStorage,
-		metaRepo:      metaRepo,
-		fragmentCount: fragmentCount,
+		objectStorage:  objectStorage,
+		metaRepo:       metaRepo,
+		health:         health,
+		cfg:            cfg,
+		prefetchMemory: semaphore.NewWeighted(cfg.PrefetchMemory),
 	}
 }
 
-// TODO: use the same servers for fragments if object with specified name already exists
+// StoreObject spreads the object over fragments according to the configured layout, stores them
+// and saves object metadata. The object is rejected when the data read doesn't match the declared size,
+// or the content digests the client declared, if any.
+//
+// Fragments get new IDs on every upload, so overwriting an object leaves its current version intact until
+// the metadata is switched to the new one; the fragments of the replaced version are then deleted
+// by the FragmentDeleter. The upload is journaled with the servers its fragment copies are stored on
+// until the metadata is saved, so a failed upload deletes them, and those of an abandoned one are deleted
+// by the UploadCleaner.
 func (m *ObjectManager) StoreObject(
-	ctx context.Context, objectName string, src io.Reader, size int64,
-) error {
+	ctx context.Context, objectName string, src io.Reader, size int64, expected model.ContentDigests,
+) (model.ObjectMeta, error) {
 	servers, err := m.metaRepo.GetServers(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get servers: %w", err)
+		return model.ObjectMeta{}, fmt.Errorf("failed to get servers: %w", err)
 	}
+
+	servers = m.placementCandidates(servers)
 	if len(servers) == 0 {
-		return fmt.Errorf("no servers available")
+		return model.ObjectMeta{}, fmt.Errorf("no servers available")
 	}
 
-	sort.Slice(servers, func(i, j int) bool {
-		return servers[i].UsedSpace < servers[j].UsedSpace
-	})
+	upload, err := m.metaRepo.CreatePendingUpload(ctx, model.PendingUpload{ObjectName: objectName, Size: size})
+	if err != nil {
+		return model.ObjectMeta{}, fmt.Errorf("failed to journal upload: %w", err)
+	}
 
-	fragmentSize := size / int64(m.fragmentCount)
-	lastFragmentSize := size - (fragmentSize * int64(m.fragmentCount-1))
+	committed := false
+	defer func() {
+		if !committed {
+			m.rollbackUpload(ctx, upload.ID)
+		}
+	}()
 
-	metaFragments := make([]model.ObjectFragmentMeta, 0, m.fragmentCount)
-	for i := 0; i < m.fragmentCount; i++ {
-		fragmentIndex := i
+	stopKeepingAlive := m.keepUploadAlive(ctx, upload.ID)
+	defer stopKeepingAlive()
+
+	counter := &countingReader{src: src}
+	objectHasher := newContentHasher(expected)
+	src = io.TeeReader(counter, objectHasher)
+
+	var (
+		layout    model.Layout
+		fragments []model.ObjectFragmentMeta
+	)
+	switch m.cfg.Layout {
+	case model.LayoutErasure:
+		layout = model.Layout{
+			Scheme:       model.LayoutErasure,
+			DataShards:   m.cfg.DataShards,
+			ParityShards: m.cfg.ParityShards,
+		}
+		fragments, err = m.storeErasureCoded(ctx, upload, servers, src)
+	default:
+		layout = model.Layout{
+			Scheme:   model.LayoutReplicated,
+			Replicas: m.cfg.Replicas,
+		}
+		fragments, err = m.storeReplicated(ctx, upload, servers, src)
+	}
+	if err != nil {
+		return model.ObjectMeta{}, err
+	}
+
+	if err := checkNoTrailingData(src); err != nil {
+		return model.ObjectMeta{}, err
+	}
+
+	if err := objectHasher.Verify(expected); err != nil {
+		return model.ObjectMeta{}, err
+	}
+
+	meta := model.ObjectMeta{
+		ObjectName: objectName,
+		Size:       size,
+		Layout:     layout,
+		Checksum:   objectHasher.Checksum(),
+		Fragments:  fragments,
+	}
+	if err := verifyStoredSize(meta, counter.n); err != nil {
+		return model.ObjectMeta{}, err
+	}
+
+	if err := m.metaRepo.CommitUpload(ctx, upload.ID, meta); err != nil {
+		return model.ObjectMeta{}, fmt.Errorf("failed to commit upload: %w", err)
+	}
+	committed = true
+
+	// Without replicas or parity, losing any server is enough to lose the object, as configured.
+	if layout.Replicas < 2 && layout.ParityShards == 0 {
+		return meta, nil
+	}
+
+	serversByID := make(map[uuid.UUID]model.Server, len(servers))
+	for _, s := range servers {
+		serversByID[s.ID] = s
+	}
+	if reasons := m.cfg.FailureDomain.placementViolations(meta, serversByID, m.cfg.Replicas); len(reasons) > 0 {
+		slog.Warn("Object stored without surviving a failure domain loss", "object", objectName,
+			"failure_domain", m.cfg.FailureDomain, "reasons", reasons)
+	}
+
+	return meta, nil
+}
+
+// storeReplicated splits the object into Config.FragmentCount fragments and stores every fragment
+// on Config.Replicas distinct servers. Each fragment is spooled, then uploaded while the next ones are read,
+// with at most Config.UploadParallelism fragments in flight. Stored copies are recorded in the upload journal.
+func (m *ObjectManager) storeReplicated(
+	ctx context.Context, pending model.PendingUpload, servers []model.Server, src io.Reader,
+) ([]model.ObjectFragmentMeta, error) {
+	objectName, size := pending.ObjectName, pending.Size
+
+	fragmentCount := m.cfg.FragmentCount
+	// Anti-affinity can't be kept with fewer servers than fragment replicas, so only replicas of a fragment
+	// go to distinct servers then.
+	distinct := !m.cfg.AllowColocation
+	if required := fragmentCount * m.cfg.Replicas; distinct && len(servers) < required {
+		slog.Warn("Not enough servers to keep fragments of object apart, colocating them", "object", objectName,
+			"servers", len(servers), "required", required)
+		distinct = false
+	}
+
+	placement, spares, err := m.placeFragments(objectName, servers, fragmentCount, m.cfg.Replicas, distinct)
+	if err != nil {
+		return nil, err
+	}
 
-		server := servers[fragmentIndex%len(servers)]
+	fragmentSize := size / int64(fragmentCount)
+	lastFragmentSize := size - (fragmentSize * int64(fragmentCount-1))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(m.cfg.UploadParallelism)
+
+	// Servers failing to store a replica are replaced by spares, taken for good unless servers may be shared.
+	pool := newServerPool(spares, distinct)
+
+	replicas := make([][]model.ObjectFragmentMeta, fragmentCount)
+	for i := 0; i < fragmentCount && gctx.Err() == nil; i++ {
+		fragmentIndex := i
+		replicaServers := placement[fragmentIndex]
 
 		currentFragmentSize := fragmentSize
-		if fragmentIndex == m.fragmentCount-1 {
+		if fragmentIndex == fragmentCount-1 {
 			currentFragmentSize = lastFragmentSize
 		}
 
-		fragmentID := getFragmentID(objectName, fragmentIndex)
-		fragmentReader := io.LimitReader(src, currentFragmentSize)
-
-		//TODO: implement retries
-		err := m.objectStorage.Store(ctx, server.Addr, fragmentID, fragmentReader)
+		s, err := spoolFragment(m.cfg.SpoolDir, src, currentFragmentSize)
 		if err != nil {
-			return fmt.Errorf("failed to store fragment: %w", err)
+			cancel()
+			return nil, errors.Join(err, g.Wait())
 		}
 
-		metaFragments = append(metaFragments, model.ObjectFragmentMeta{
-			SeqNum:       fragmentIndex,
-			ServerID:     server.ID,
-			FragmentID:   fragmentID,
-			FragmentSize: currentFragmentSize,
+		g.Go(func() error {
+			defer closeSpool(s)
+
+			fragmentID := uuid.New()
+
+			placed := m.journalFragment(pending.ID, fragmentIndex, fragmentID, currentFragmentSize)
+			checksum, err := m.storeReplicas(gctx, replicaServers, pool, fragmentID, s, placed)
+			if err != nil {
+				return fmt.Errorf("failed to store fragment %d: %w", fragmentIndex, err)
+			}
+
+			for r, server := range replicaServers {
+				replicas[fragmentIndex] = append(replicas[fragmentIndex], model.ObjectFragmentMeta{
+					SeqNum:       fragmentIndex,
+					Replica:      r,
+					ServerID:     server.ID,
+					FragmentID:   fragmentID,
+					FragmentSize: currentFragmentSize,
+					Checksum:     checksum,
+				})
+			}
+
+			return nil
 		})
 	}
 
-	return m.metaRepo.SaveObjectMeta(ctx, model.ObjectMeta{
-		ObjectName: objectName,
-		Fragments:  metaFragments,
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return slices.Concat(replicas...), nil
+}
+
+// placementCandidates leaves out servers that are not schedulable or down.
+func (m *ObjectManager) placementCandidates(servers []model.Server) []model.Server {
+	candidates := make([]model.Server, 0, len(servers))
+	for _, s := range servers {
+		if s.Schedulable() && m.health.State(s.ID) != model.HealthDown {
+			candidates = append(candidates, s)
+		}
+	}
+
+	return candidates
+}
+
+// placeFragments picks the servers of every fragment of the object: the i-th element holds
+// the servers of the replicas of the i-th fragment. Servers are picked to spread replicas of each fragment,
+// then all fragments of the object, evenly across failure domains (see Config.FailureDomain).
+// Within that, degraded servers are only picked when healthy ones are not enough, and the most preferred
+// by Config.Placement go first. With distinct set, no server is picked twice; otherwise only replicas of one fragment
+// are on distinct servers, and servers already picked for the object are reused only when there are no others.
+// Spares to replace failing servers are returned ordered by preference:
+// with distinct set, the servers not picked, otherwise all of them.
+func (m *ObjectManager) placeFragments(
+	objectName string, servers []model.Server, fragmentCount, replicas int, distinct bool,
+) ([][]model.Server, []model.Server, error) {
+	required := replicas
+	if distinct {
+		required = fragmentCount * replicas
+	}
+	if len(servers) < required {
+		return nil, nil, fmt.Errorf(
+			"%d servers available, %d required: %w", len(servers), required, model.ErrNotEnoughServers,
+		)
+	}
+
+	degraded := func(s model.Server) int {
+		if m.health.State(s.ID) == model.HealthDegraded {
+			return 1
+		}
+		return 0
+	}
+
+	picked := make(map[uuid.UUID]int, required)
+	objectDomains := make(map[string]int)
+
+	placement := make([][]model.Server, fragmentCount)
+	for i := range placement {
+		ranked := m.cfg.Placement.Rank(fragmentKey(objectName, i), servers)
+		fragmentDomains := make(map[string]int, replicas)
+
+		for range replicas {
+			var (
+				best      model.Server
+				bestScore []int
+			)
+			for _, s := range ranked {
+				if (distinct && picked[s.ID] > 0) || slices.ContainsFunc(placement[i], func(p model.Server) bool {
+					return p.ID == s.ID
+				}) {
+					continue
+				}
+
+				domain := m.cfg.FailureDomain.domainOf(s)
+				score := []int{fragmentDomains[domain], objectDomains[domain], degraded(s), picked[s.ID]}
+				if bestScore == nil || slices.Compare(score, bestScore) < 0 {
+					best, bestScore = s, score
+				}
+			}
+
+			placement[i] = append(placement[i], best)
+			picked[best.ID]++
+			domain := m.cfg.FailureDomain.domainOf(best)
+			fragmentDomains[domain]++
+			objectDomains[domain]++
+		}
+	}
+
+	spares := m.cfg.Placement.Rank(objectName, servers)
+	if distinct {
+		spares = slices.DeleteFunc(spares, func(s model.Server) bool {
+			return picked[s.ID] > 0
+		})
+	}
+	sort.SliceStable(spares, func(i, j int) bool {
+		if di, dj := degraded(spares[i]), degraded(spares[j]); di != dj {
+			return di < dj
+		}
+		return picked[spares[i].ID] < picked[spares[j].ID]
 	})
+
+	return placement, spares, nil
 }
 
-func getFragmentID(objectName string, seqNum int) uuid.UUID {
-	return uuid.NewSHA1(uuid.UUID{}, []byte(fmt.Sprintf("%s-%d", objectName, seqNum)))
+func fragmentKey(objectName string, seqNum int) string {
+	return fmt.Sprintf("%s-%d", objectName, seqNum)
 }
 
-func (m *ObjectManager) RetrieveObject(ctx context.Context, objectName string, dst io.Writer) error {
+func (m *ObjectManager) GetObjectMeta(ctx context.Context, objectName string) (model.ObjectMeta, error) {
 	meta, err := m.metaRepo.GetObjectMeta(ctx, objectName)
 	if err != nil {
-		return fmt.Errorf("failed to get object meta: %w", err)
+		return model.ObjectMeta{}, fmt.Errorf("failed to get object meta: %w", err)
 	}
 
-	sort.Slice(meta.Fragments, func(i, j int) bool {
-		return meta.Fragments[i].SeqNum < meta.Fragments[j].SeqNum
-	})
+	return meta, nil
+}
 
-	servers, err := m.metaRepo.GetServers(ctx)
+// RetrieveObject writes length bytes of the object starting at offset to dst.
+// Only fragments overlapping the requested range are fetched, from the first replica able to serve them
+// or, with the erasure layout, restored from other shards. Checksums of fragments read in full,
+// and of the object when read in full, are verified. An object of unknown size can only be read in full,
+// asked with zero offset and length. Downloads taking longer than Config.DownloadTimeout are canceled,
+// since the fragments they read may be deleted afterwards.
+func (m *ObjectManager) RetrieveObject(
+	ctx context.Context, meta model.ObjectMeta, offset, length int64, dst io.Writer,
+) error {
+	if offset < 0 || length < 0 || offset+length > meta.Size {
+		return fmt.Errorf("range %d-%d of %d bytes: %w", offset, offset+length, meta.Size, model.ErrInvalidRange)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.DownloadTimeout)
+	defer cancel()
+
+	serversByID, err := m.getServersByID(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get servers: %w", err)
+		return err
 	}
-	if len(servers) == 0 {
-		return fmt.Errorf("no servers available")
+
+	if meta.SizeUnknown {
+		return m.retrieveUnsized(ctx, serversByID, meta, dst)
 	}
 
-	serversByID := make(map[uuid.UUID]model.Server, len(servers))
-	for _, s := range servers {
-		serversByID[s.ID] = s
+	var objectWriter *checksumWriter
+	if offset == 0 && length == meta.Size && meta.Checksum != "" {
+		objectWriter = newChecksumWriter(dst)
+		dst = objectWriter
 	}
 
-	for _, f := range meta.Fragments {
-		server, ok := serversByID[f.ServerID]
-		if !ok {
-			return fmt.Errorf("server '%s' not found: %w", f.ServerID, model.ErrServerNotFound)
+	if meta.Layout.Scheme == model.LayoutErasure {
+		err = m.retrieveErasureCoded(ctx, serversByID, meta, offset, length, dst)
+	} else {
+		err = m.retrieveReplicated(ctx, serversByID, meta, offset, length, dst)
+	}
+	if err != nil {
+		return err
+	}
+
+	if objectWriter != nil {
+		if err := objectWriter.Verify(meta.Checksum); err != nil {
+			return fmt.Errorf("object '%s': %w", meta.ObjectName, err)
 		}
+	}
 
-		//TODO: implement retries
-		if err := m.objectStorage.Retrieve(ctx, server.Addr, f.FragmentID, dst); err != nil {
-			return fmt.Errorf("failed to retrieve fragment '%s': %w", f.FragmentID, err)
+	return nil
+}
+
+func (m *ObjectManager) retrieveReplicated(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, meta model.ObjectMeta,
+	offset, length int64, dst io.Writer,
+) error {
+	end := offset + length
+	var (
+		ranges        []fragmentRange
+		fragmentStart int64
+	)
+	for _, replicas := range meta.ReplicaGroups() {
+		f := replicas[0]
+
+		fragmentEnd := fragmentStart + f.FragmentSize
+		if fragmentEnd <= offset || fragmentStart >= end || f.FragmentSize == 0 {
+			fragmentStart = fragmentEnd
+			continue
+		}
+
+		fragmentOffset := max(offset-fragmentStart, 0)
+		ranges = append(ranges, fragmentRange{
+			seqNum:   f.SeqNum,
+			replicas: replicas,
+			offset:   fragmentOffset,
+			length:   min(end, fragmentEnd) - fragmentStart - fragmentOffset,
+		})
+
+		fragmentStart = fragmentEnd
+	}
+
+	return m.retrievePipelined(ctx, ranges, func(ctx context.Context, r fragmentRange, dst io.Writer) error {
+		if err := m.retrieveReplicas(ctx, serversByID, r.replicas, r.offset, r.length, dst); err != nil {
+			return fmt.Errorf("failed to retrieve fragment '%s': %w", r.replicas[0].FragmentID, err)
+		}
+		return nil
+	}, dst)
+}
+
+// retrieveUnsized writes the fragments of an object of unknown size to dst in full, one after another.
+// A replica failing midway is replaced by the next one reading from where the previous one stopped.
+func (m *ObjectManager) retrieveUnsized(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, meta model.ObjectMeta, dst io.Writer,
+) error {
+	for _, replicas := range meta.ReplicaGroups() {
+		counter := &countingWriter{dst: dst}
+
+		var errs []error
+		for _, r := range replicas {
+			server, ok := serversByID[r.ServerID]
+			if !ok {
+				errs = append(errs, fmt.Errorf("server '%s' not found: %w", r.ServerID, model.ErrServerNotFound))
+				continue
+			}
+
+			// A zero length reads up to the end of the fragment.
+			err := m.retry(ctx, "retrieve", server.Addr, func(ctx context.Context) error {
+				return m.objectStorage.Retrieve(ctx, server.Addr, r.FragmentID, counter.n, 0, counter)
+			})
+			if err == nil {
+				errs = nil
+				break
+			}
+			errs = append(errs, fmt.Errorf("server '%s': %w", server.Addr, err))
+		}
+
+		if len(errs) > 0 {
+			return fmt.Errorf("failed to retrieve fragment '%s': %w", replicas[0].FragmentID, errors.Join(errs...))
 		}
 	}
 
 	return nil
 }
+
+// DeleteObject removes the object metadata and queues its fragments for deletion by the FragmentDeleter,
+// so downloads already started can finish.
+func (m *ObjectManager) DeleteObject(ctx context.Context, objectName string) error {
+	if err := m.metaRepo.DeleteObjectMeta(ctx, objectName); err != nil {
+		return fmt.Errorf("failed to delete object meta: %w", err)
+	}
+
+	return nil
+}
+
+func (m *ObjectManager) getServersByID(ctx context.Context) (map[uuid.UUID]model.Server, error) {
+	servers, err := m.metaRepo.GetServers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get servers: %w", err)
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no servers available")
+	}
+
+	serversByID := make(map[uuid.UUID]model.Server, len(servers))
+	for _, s := range servers {
+		serversByID[s.ID] = s
+	}
+
+	return serversByID, nil
+}
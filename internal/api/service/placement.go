@@ -0,0 +1,155 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+type PlacementStrategy string
+
+const (
+	PlacementLeastUsed      PlacementStrategy = "least-used"
+	PlacementWeightedRandom PlacementStrategy = "weighted-random"
+	PlacementRendezvous     PlacementStrategy = "rendezvous"
+)
+
+// Placement decides which servers fragments are stored on.
+type Placement interface {
+	// Rank returns the servers ordered by preference for storing the fragment with the given key.
+	// The servers slice itself is left unchanged.
+	Rank(key string, servers []model.Server) []model.Server
+}
+
+func NewPlacement(strategy PlacementStrategy) (Placement, error) {
+	switch strategy {
+	case PlacementLeastUsed, "":
+		return LeastUsedPlacement{}, nil
+	case PlacementWeightedRandom:
+		return WeightedRandomPlacement{}, nil
+	case PlacementRendezvous:
+		return RendezvousPlacement{}, nil
+	default:
+		return nil, fmt.Errorf("unknown placement strategy '%s'", strategy)
+	}
+}
+
+// LeastUsedPlacement prefers servers with the lowest share of their capacity used.
+// Servers with unknown capacity come after the others, ordered by used space.
+type LeastUsedPlacement struct{}
+
+func (LeastUsedPlacement) Rank(_ string, servers []model.Server) []model.Server {
+	usage := func(s model.Server) float64 {
+		if s.Capacity <= 0 {
+			return math.Inf(1)
+		}
+		return float64(s.UsedSpace) / float64(s.Capacity)
+	}
+
+	ranked := slices.Clone(servers)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ui, uj := usage(ranked[i]), usage(ranked[j]); ui != uj {
+			return ui < uj
+		}
+		return ranked[i].UsedSpace < ranked[j].UsedSpace
+	})
+
+	return ranked
+}
+
+// WeightedRandomPlacement orders servers randomly, each one coming first with a probability
+// proportional to its free space. Full servers come last.
+type WeightedRandomPlacement struct{}
+
+func (WeightedRandomPlacement) Rank(_ string, servers []model.Server) []model.Server {
+	weights := capacityWeights(servers, func(s model.Server) float64 {
+		return float64(max(s.Capacity-s.UsedSpace, 0))
+	})
+
+	// Sorting by exponentially distributed keys scaled by the weights draws servers
+	// one by one without replacement, see Efraimidis and Spirakis.
+	keys := make([]float64, len(servers))
+	for i := range servers {
+		keys[i] = rand.ExpFloat64() / weights[i]
+	}
+
+	return rankByScore(servers, keys, false)
+}
+
+// RendezvousPlacement orders servers by highest random weight hashing of the fragment key, weighted by capacity.
+// The same fragment always gets the same servers, and adding or removing a server only moves
+// the fragments it gains or loses.
+type RendezvousPlacement struct{}
+
+func (RendezvousPlacement) Rank(key string, servers []model.Server) []model.Server {
+	weights := capacityWeights(servers, func(s model.Server) float64 {
+		return float64(s.Capacity)
+	})
+
+	scores := make([]float64, len(servers))
+	for i, s := range servers {
+		sum := sha256.Sum256([]byte(key + "/" + s.ID.String()))
+		// A uniform value in (0, 1) out of the top 53 bits of the hash.
+		u := (float64(binary.BigEndian.Uint64(sum[:8])>>11) + 0.5) / (1 << 53)
+		scores[i] = -weights[i] / math.Log(u)
+	}
+
+	return rankByScore(servers, scores, true)
+}
+
+// capacityWeights returns the weight of every server. Servers with unknown capacity get the mean weight
+// of the others, and all servers weigh the same if no capacity is known.
+func capacityWeights(servers []model.Server, weight func(s model.Server) float64) []float64 {
+	var (
+		sum   float64
+		known int
+	)
+	for _, s := range servers {
+		if s.Capacity > 0 {
+			sum += weight(s)
+			known++
+		}
+	}
+
+	fallback := 1.0
+	if known > 0 && sum > 0 {
+		fallback = sum / float64(known)
+	}
+
+	weights := make([]float64, len(servers))
+	for i, s := range servers {
+		if s.Capacity > 0 {
+			weights[i] = weight(s)
+		} else {
+			weights[i] = fallback
+		}
+	}
+
+	return weights
+}
+
+func rankByScore(servers []model.Server, scores []float64, descending bool) []model.Server {
+	order := make([]int, len(servers))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		if descending {
+			return scores[order[i]] > scores[order[j]]
+		}
+		return scores[order[i]] < scores[order[j]]
+	})
+
+	ranked := make([]model.Server, 0, len(servers))
+	for _, i := range order {
+		ranked = append(ranked, servers[i])
+	}
+
+	return ranked
+}
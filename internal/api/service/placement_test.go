@@ -0,0 +1,266 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+func serverAddrs(servers []model.Server) []string {
+	addrs := make([]string, 0, len(servers))
+	for _, s := range servers {
+		addrs = append(addrs, s.Addr)
+	}
+	return addrs
+}
+
+func TestLeastUsedPlacementRank(t *testing.T) {
+	servers := []model.Server{
+		{Addr: "unknown-busy", UsedSpace: 500},
+		{Addr: "half", UsedSpace: 500, Capacity: 1000},
+		{Addr: "unknown-idle", UsedSpace: 100},
+		{Addr: "tenth", UsedSpace: 1000, Capacity: 10_000},
+		{Addr: "empty", Capacity: 10},
+	}
+	want := []string{"empty", "tenth", "half", "unknown-idle", "unknown-busy"}
+
+	if got := serverAddrs(LeastUsedPlacement{}.Rank("key", servers)); !slices.Equal(got, want) {
+		t.Errorf("Rank() = %v, want %v", got, want)
+	}
+	if servers[0].Addr != "unknown-busy" {
+		t.Errorf("Rank() reordered its argument")
+	}
+}
+
+func TestRendezvousPlacementRank(t *testing.T) {
+	servers := newTestServers(5)
+	p := RendezvousPlacement{}
+
+	first := p.Rank("object-0", servers)
+	if again := p.Rank("object-0", servers); !slices.Equal(serverAddrs(again), serverAddrs(first)) {
+		t.Errorf("Rank() of the same key = %v, then %v", serverAddrs(first), serverAddrs(again))
+	}
+
+	// Removing a server leaves the order of the others as it was.
+	for _, removed := range servers {
+		rest := slices.DeleteFunc(slices.Clone(servers), func(s model.Server) bool { return s.ID == removed.ID })
+		want := slices.DeleteFunc(serverAddrs(first), func(addr string) bool { return addr == removed.Addr })
+		if got := serverAddrs(p.Rank("object-0", rest)); !slices.Equal(got, want) {
+			t.Errorf("Rank() without %s = %v, want %v", removed.Addr, got, want)
+		}
+	}
+}
+
+func TestRendezvousPlacementWeightedByCapacity(t *testing.T) {
+	servers := newTestServers(3)
+	servers[0].Capacity *= 3
+
+	const keys = 10_000
+	firsts := make(map[string]int)
+	for i := range keys {
+		firsts[RendezvousPlacement{}.Rank(fmt.Sprintf("object-%d", i), servers)[0].Addr]++
+	}
+
+	// The large server comes first for 3/5 of the keys, every other one for 1/5.
+	assertShare(t, firsts[servers[0].Addr], keys, 0.6)
+	assertShare(t, firsts[servers[1].Addr], keys, 0.2)
+	assertShare(t, firsts[servers[2].Addr], keys, 0.2)
+}
+
+func TestWeightedRandomPlacementRank(t *testing.T) {
+	servers := newTestServers(4)
+	servers[0].UsedSpace = servers[0].Capacity / 2
+	servers[1].UsedSpace = servers[1].Capacity
+	servers[3].Capacity = 0
+
+	const draws = 20_000
+	firsts := make(map[string]int)
+	for range draws {
+		ranked := WeightedRandomPlacement{}.Rank("", servers)
+
+		if got := serverAddrs(ranked); !slices.Equal(sortedStrings(got), sortedStrings(serverAddrs(servers))) {
+			t.Fatalf("Rank() = %v, not a permutation of the servers", got)
+		}
+		if ranked[len(ranked)-1].Addr != servers[1].Addr {
+			t.Fatalf("Rank() = %v, full server %s is not last", serverAddrs(ranked), servers[1].Addr)
+		}
+		firsts[ranked[0].Addr]++
+	}
+
+	// Free space weighs 1/2, 0 and 1, and the server of unknown capacity gets the mean of the known ones, 1/2.
+	assertShare(t, firsts[servers[0].Addr], draws, 0.25)
+	assertShare(t, firsts[servers[1].Addr], draws, 0)
+	assertShare(t, firsts[servers[2].Addr], draws, 0.5)
+	assertShare(t, firsts[servers[3].Addr], draws, 0.25)
+}
+
+func sortedStrings(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
+
+func assertShare(t *testing.T, count, total int, want float64) {
+	t.Helper()
+
+	if got := float64(count) / float64(total); got < want-0.03 || got > want+0.03 {
+		t.Errorf("share = %.3f, want %.2f", got, want)
+	}
+}
+
+func TestPlaceFragmentsSpreadsAcrossDomains(t *testing.T) {
+	servers := newTestServers(6, "r1", "r2", "r3")
+	m, _, _ := newTestObjectManager(Config{FailureDomain: FailureDomainRack}, servers)
+
+	placement, spares, err := m.placeFragments("object", servers, 3, 2, true)
+	if err != nil {
+		t.Fatalf("placeFragments() error = %v", err)
+	}
+
+	picked := make(map[uuid.UUID]bool)
+	rackFragments := make(map[string]int)
+	for i, replicas := range placement {
+		if len(replicas) != 2 {
+			t.Fatalf("fragment %d has %d replicas, want 2", i, len(replicas))
+		}
+		if replicas[0].Labels[model.LabelRack] == replicas[1].Labels[model.LabelRack] {
+			t.Errorf("replicas of fragment %d are both in rack %s", i, replicas[0].Labels[model.LabelRack])
+		}
+		for _, s := range replicas {
+			if picked[s.ID] {
+				t.Errorf("server %s picked twice", s.Addr)
+			}
+			picked[s.ID] = true
+			rackFragments[s.Labels[model.LabelRack]]++
+		}
+	}
+	for _, rack := range []string{"r1", "r2", "r3"} {
+		if rackFragments[rack] != 2 {
+			t.Errorf("rack %s holds %d fragment copies, want 2", rack, rackFragments[rack])
+		}
+	}
+	if len(spares) != 0 {
+		t.Errorf("spares = %v, want none", serverAddrs(spares))
+	}
+}
+
+func TestPlaceFragmentsAvoidsDegradedServers(t *testing.T) {
+	servers := newTestServers(4)
+	m, _, _ := newTestObjectManager(Config{FailureDomain: FailureDomainServer}, servers)
+	m.health = staticHealth{servers[0].ID: model.HealthDegraded}
+
+	placement, spares, err := m.placeFragments("object", servers, 1, 2, true)
+	if err != nil {
+		t.Fatalf("placeFragments() error = %v", err)
+	}
+
+	for _, s := range placement[0] {
+		if s.ID == servers[0].ID {
+			t.Errorf("degraded server %s picked while healthy ones are left", s.Addr)
+		}
+	}
+	if len(spares) != 2 || spares[1].ID != servers[0].ID {
+		t.Errorf("spares = %v, want the degraded server last", serverAddrs(spares))
+	}
+
+	// Degraded servers are picked when healthy ones are not enough.
+	placement, _, err = m.placeFragments("object", servers, 1, 4, true)
+	if err != nil {
+		t.Fatalf("placeFragments() error = %v", err)
+	}
+	if got := len(placement[0]); got != 4 {
+		t.Errorf("fragment has %d replicas, want 4", got)
+	}
+}
+
+func TestPlaceFragmentsNotEnoughServers(t *testing.T) {
+	servers := newTestServers(3)
+	m, _, _ := newTestObjectManager(Config{}, servers)
+
+	if _, _, err := m.placeFragments("object", servers, 2, 2, true); !errors.Is(err, model.ErrNotEnoughServers) {
+		t.Errorf("placeFragments() with distinct servers error = %v, want %v", err, model.ErrNotEnoughServers)
+	}
+	if _, _, err := m.placeFragments("object", servers, 1, 4, false); !errors.Is(err, model.ErrNotEnoughServers) {
+		t.Errorf("placeFragments() with too many replicas error = %v, want %v", err, model.ErrNotEnoughServers)
+	}
+}
+
+func TestPlaceFragmentsReusesServersLast(t *testing.T) {
+	servers := newTestServers(2)
+	m, _, _ := newTestObjectManager(Config{FailureDomain: FailureDomainServer}, servers)
+
+	placement, spares, err := m.placeFragments("object", servers, 3, 1, false)
+	if err != nil {
+		t.Fatalf("placeFragments() error = %v", err)
+	}
+
+	counts := make(map[uuid.UUID]int)
+	for _, replicas := range placement {
+		counts[replicas[0].ID]++
+	}
+	if counts[servers[0].ID]+counts[servers[1].ID] != 3 || min(counts[servers[0].ID], counts[servers[1].ID]) != 1 {
+		t.Errorf("fragments per server = %v, want 2 and 1", counts)
+	}
+	if len(spares) != 2 {
+		t.Errorf("spares = %v, want all servers", serverAddrs(spares))
+	}
+}
+
+func TestStoreReplicatedColocatesWithTooFewServers(t *testing.T) {
+	tests := []struct {
+		name            string
+		servers         int
+		wantAllDistinct bool
+	}{
+		{name: "enough servers", servers: 12, wantAllDistinct: true},
+		{name: "too few servers", servers: 4, wantAllDistinct: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, _ := newTestObjectManager(Config{
+				FragmentCount: 6,
+				Replicas:      2,
+				FailureDomain: FailureDomainServer,
+			}, newTestServers(tt.servers))
+
+			data := testData(6000)
+			meta, err := m.StoreObject(context.Background(), "object", bytes.NewReader(data), int64(len(data)),
+				model.ContentDigests{})
+			if err != nil {
+				t.Fatalf("StoreObject() error = %v", err)
+			}
+
+			used := make(map[uuid.UUID]int)
+			for _, replicas := range meta.ReplicaGroups() {
+				if len(replicas) != 2 || replicas[0].ServerID == replicas[1].ServerID {
+					t.Fatalf("replicas of fragment %d are not on 2 distinct servers", replicas[0].SeqNum)
+				}
+				for _, r := range replicas {
+					used[r.ServerID]++
+				}
+			}
+			if allDistinct := len(used) == 12; allDistinct != tt.wantAllDistinct {
+				t.Errorf("%d servers used for 12 fragment copies", len(used))
+			}
+			if len(used) != tt.servers {
+				t.Errorf("%d of %d servers used", len(used), tt.servers)
+			}
+
+			var buf bytes.Buffer
+			if err := m.RetrieveObject(context.Background(), meta, 0, meta.Size, &buf); err != nil {
+				t.Fatalf("RetrieveObject() error = %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Errorf("RetrieveObject() returned different bytes")
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+// fragmentRange is the part of a fragment needed to serve a requested object range.
+type fragmentRange struct {
+	seqNum   int
+	replicas []model.ObjectFragmentMeta
+	offset   int64
+	length   int64
+}
+
+type fetchFunc func(ctx context.Context, r fragmentRange, dst io.Writer) error
+
+type prefetchedRange struct {
+	buf  bytes.Buffer
+	err  error
+	done chan struct{}
+	// reserved is whether the range holds its length of the shared prefetch memory.
+	reserved bool
+}
+
+// retrievePipelined writes the fragment ranges to dst in order while fetching the next ones concurrently
+// into memory, up to Config.PrefetchDepth ranges ahead, within the Config.PrefetchMemory bytes shared by all downloads.
+// Ranges larger than the memory limit are not prefetched, but streamed to dst when their turn comes.
+func (m *ObjectManager) retrievePipelined(
+	ctx context.Context, ranges []fragmentRange, fetch fetchFunc, dst io.Writer,
+) error {
+	if len(ranges) == 1 {
+		return fetch(ctx, ranges[0], dst)
+	}
+
+	depth := semaphore.NewWeighted(int64(m.cfg.PrefetchDepth))
+	memory := m.prefetchMemory
+
+	prefetched := make([]*prefetchedRange, len(ranges))
+	for i, r := range ranges {
+		if r.length <= m.cfg.PrefetchMemory {
+			prefetched[i] = &prefetchedRange{done: make(chan struct{})}
+		}
+	}
+
+	// The memory is shared by all downloads, so ranges left unconsumed by a failed or canceled download
+	// are given back once nothing fetches them anymore.
+	defer func() {
+		for i, p := range prefetched {
+			if p != nil && p.reserved {
+				memory.Release(ranges[i].length)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i, r := range ranges {
+			p := prefetched[i]
+			if p == nil {
+				continue
+			}
+
+			if err := depth.Acquire(ctx, 1); err != nil {
+				return
+			}
+			if err := memory.Acquire(ctx, r.length); err != nil {
+				return
+			}
+			p.reserved = true
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer close(p.done)
+
+				p.buf.Grow(int(r.length))
+				p.err = fetch(ctx, r, &p.buf)
+				if p.err != nil {
+					p.buf = bytes.Buffer{}
+					p.reserved = false
+					memory.Release(r.length)
+				}
+			}()
+		}
+	}()
+
+	for i, r := range ranges {
+		p := prefetched[i]
+		if p == nil {
+			if err := fetch(ctx, r, dst); err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		depth.Release(1)
+
+		if p.err != nil {
+			return p.err
+		}
+
+		_, err := p.buf.WriteTo(dst)
+		p.buf = bytes.Buffer{}
+		p.reserved = false
+		memory.Release(r.length)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
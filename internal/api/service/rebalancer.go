@@ -0,0 +1,413 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+const (
+	defaultRebalanceInterval        = time.Minute
+	defaultRebalanceThreshold       = 0.1
+	defaultRebalanceMovesPerRound   = 100
+	defaultRebalanceMaxAttempts     = 5
+	defaultRebalanceSourceRetention = defaultDownloadTimeout
+	defaultRebalanceFailedRetention = time.Hour
+
+	// rebalancerLockKey is the advisory lock key letting a single API server run the rebalancer.
+	rebalancerLockKey int64 = 0x5353_0001
+)
+
+type rebalanceRepository interface {
+	moveRepository
+	CreateFragmentMoves(ctx context.Context, moves []model.FragmentMove) error
+	ListServerObjects(ctx context.Context, serverID uuid.UUID, after string, limit int) ([]model.ObjectMeta, error)
+	TryLock(ctx context.Context, key int64) (func(), bool, error)
+}
+
+type RebalanceConfig struct {
+	// Interval is the period of rebalancing rounds.
+	Interval time.Duration
+	// Threshold is how far above the mean share of capacity used a server has to be
+	// for its fragments to be moved to servers below the mean.
+	Threshold float64
+	// MovesPerRound is the maximum number of fragment moves planned in a round.
+	MovesPerRound int
+	// Bandwidth is the maximum number of bytes per second copied between servers. Zero means no limit.
+	Bandwidth int64
+	// MaxAttempts is the number of failed attempts after which a move gives up.
+	MaxAttempts int
+	// SourceRetention is the time source copies are kept after moving, so downloads already started can finish.
+	// It must be at least Config.DownloadTimeout.
+	SourceRetention time.Duration
+	// FailedRetention is the time failed moves are kept before their fragments may be moved again.
+	FailedRetention time.Duration
+	// DrainOnly turns off balancing, leaving only moves off draining servers.
+	DrainOnly bool
+	// AllowColocation and FailureDomain are the placement policy moves must keep, see Config.
+	AllowColocation bool
+	FailureDomain   FailureDomain
+}
+
+func (cfg *RebalanceConfig) SetDefaults() {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultRebalanceInterval
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = defaultRebalanceThreshold
+	}
+	if cfg.MovesPerRound <= 0 {
+		cfg.MovesPerRound = defaultRebalanceMovesPerRound
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultRebalanceMaxAttempts
+	}
+	if cfg.SourceRetention <= 0 {
+		cfg.SourceRetention = defaultRebalanceSourceRetention
+	}
+	if cfg.FailedRetention <= 0 {
+		cfg.FailedRetention = defaultRebalanceFailedRetention
+	}
+	if cfg.FailureDomain == "" {
+		cfg.FailureDomain = FailureDomainRack
+	}
+}
+
+// Rebalancer moves fragments from servers using a larger share of their capacity than the others
+// to the least used ones, so servers added to the cluster take their part of the stored data.
+// It also moves all fragments off draining servers.
+type Rebalancer struct {
+	repo   rebalanceRepository
+	health serverHealth
+	mover  *fragmentMover
+	cfg    RebalanceConfig
+}
+
+func NewRebalancer(
+	storage fragmentStorage, repo rebalanceRepository, health serverHealth, cfg RebalanceConfig,
+) *Rebalancer {
+	cfg.SetDefaults()
+
+	return &Rebalancer{
+		repo:   repo,
+		health: health,
+		mover:  newFragmentMover(storage, repo, cfg.Bandwidth, cfg.MaxAttempts, cfg.SourceRetention),
+		cfg:    cfg,
+	}
+}
+
+// Run rebalances servers until the context is canceled. Only one API server sharing the database runs rounds
+// at a time. Moves are queued in the database, so moves interrupted by a restart resume with the next round.
+func (r *Rebalancer) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		release, acquired, err := r.repo.TryLock(ctx, rebalancerLockKey)
+		if err != nil {
+			slog.Error("Failed to take rebalancer lock", "err", err)
+			continue
+		}
+		if !acquired {
+			continue
+		}
+
+		if err := r.round(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Rebalancing round failed", "err", err)
+		}
+		release()
+	}
+}
+
+// round plans new moves once the previous ones are done, then carries out the queued ones.
+func (r *Rebalancer) round(ctx context.Context) error {
+	moves, err := r.repo.GetFragmentMoves(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get fragment moves: %w", err)
+	}
+
+	active := false
+	failed := make(map[moveKey]bool)
+	for _, m := range moves {
+		switch {
+		case m.State != model.MoveFailed:
+			active = true
+		case time.Since(m.UpdatedAt) < r.cfg.FailedRetention:
+			failed[moveKey{m.FragmentID, m.SourceServerID}] = true
+		default:
+			if err := r.repo.DeleteFragmentMove(ctx, m.ID); err != nil {
+				return fmt.Errorf("failed to delete failed move: %w", err)
+			}
+		}
+	}
+
+	if !active {
+		planned, err := r.plan(ctx, failed)
+		if err != nil {
+			return err
+		}
+		if err := r.repo.CreateFragmentMoves(ctx, planned); err != nil {
+			return fmt.Errorf("failed to queue fragment moves: %w", err)
+		}
+		if len(planned) > 0 {
+			slog.Info("Rebalancing planned", "moves", len(planned))
+		}
+	}
+
+	return r.mover.runMoves(ctx)
+}
+
+type moveKey struct {
+	fragmentID uuid.UUID
+	serverID   uuid.UUID
+}
+
+// plan picks fragments to move off draining servers, then fragments to move from servers using more than the mean
+// share of capacity plus Threshold to servers below the mean, until MovesPerRound moves are planned.
+// Fragment copies in the failed set are skipped.
+func (r *Rebalancer) plan(ctx context.Context, failed map[moveKey]bool) ([]model.FragmentMove, error) {
+	servers, err := r.repo.GetServers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	p := &movePlan{
+		serversByID: make(map[uuid.UUID]model.Server, len(servers)),
+		failed:      failed,
+		limit:       r.cfg.MovesPerRound,
+	}
+
+	var usage []*serverUsage
+	for _, s := range servers {
+		p.serversByID[s.ID] = s
+		if !s.Stale && r.health.State(s.ID) != model.HealthDown {
+			usage = append(usage, &serverUsage{server: s, used: s.UsedSpace})
+		}
+	}
+
+	if err := r.planDrain(ctx, p, usage); err != nil {
+		return nil, err
+	}
+	if !r.cfg.DrainOnly {
+		if err := r.planBalance(ctx, p, usage); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.moves, nil
+}
+
+// planDrain moves all fragments off draining servers to the least used servers able to take them,
+// keeping the placement policy where possible. Draining servers that are unreachable wait until they come back.
+func (r *Rebalancer) planDrain(ctx context.Context, p *movePlan, usage []*serverUsage) error {
+	var sources, targets []*serverUsage
+	for _, u := range usage {
+		switch {
+		case u.server.Status == model.ServerDraining:
+			sources = append(sources, u)
+		case u.server.Schedulable() && r.health.State(u.server.ID) != model.HealthDegraded:
+			targets = append(targets, u)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	for _, source := range sources {
+		err := r.planSource(ctx, p, source, targets, model.MoveDrain, false, func(t *serverUsage, size int64) bool {
+			return t.server.Capacity <= 0 || t.used+size <= t.server.Capacity
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// planBalance moves fragments from servers above the mean share of capacity used plus Threshold
+// to servers below the mean, until the sources get down to the mean. Servers with unknown capacity are left alone.
+func (r *Rebalancer) planBalance(ctx context.Context, p *movePlan, usage []*serverUsage) error {
+	var (
+		balanced       []*serverUsage
+		used, capacity int64
+	)
+	for _, u := range usage {
+		if u.server.Capacity > 0 && u.server.Status != model.ServerDraining {
+			balanced = append(balanced, u)
+			used += u.used
+			capacity += u.server.Capacity
+		}
+	}
+	if capacity == 0 {
+		return nil
+	}
+	mean := float64(used) / float64(capacity)
+
+	var sources, targets []*serverUsage
+	for _, u := range balanced {
+		switch {
+		case u.utilization() > mean+r.cfg.Threshold:
+			sources = append(sources, u)
+		case u.utilization() < mean && u.server.Schedulable() && r.health.State(u.server.ID) != model.HealthDegraded:
+			targets = append(targets, u)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].utilization() > sources[j].utilization()
+	})
+
+	for _, source := range sources {
+		if source.utilization() <= mean {
+			continue
+		}
+		err := r.planSource(ctx, p, source, targets, model.MoveRebalance, true, func(t *serverUsage, size int64) bool {
+			return source.utilization() > mean && float64(t.used+size)/float64(t.server.Capacity) <= mean
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// planSource plans moves of the fragments on the source server to the targets fitting them, until none fits
+// or the plan is full. With keepPlacement, moves must not add placement violations to the object.
+func (r *Rebalancer) planSource(
+	ctx context.Context, p *movePlan, source *serverUsage, targets []*serverUsage, reason model.MoveReason,
+	keepPlacement bool, fits func(t *serverUsage, size int64) bool,
+) error {
+	after := ""
+	for !p.full() {
+		metas, err := r.repo.ListServerObjects(ctx, source.server.ID, after, objectBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list objects of server '%s': %w", source.server.Addr, err)
+		}
+
+		for _, meta := range metas {
+			for i, f := range meta.Fragments {
+				if f.ServerID != source.server.ID || p.failed[moveKey{f.FragmentID, f.ServerID}] {
+					continue
+				}
+				if p.full() || !slices.ContainsFunc(targets, func(t *serverUsage) bool {
+					return fits(t, f.FragmentSize)
+				}) {
+					return nil
+				}
+
+				target := r.pickTarget(p, meta, i, targets, keepPlacement, fits)
+				if target == nil {
+					continue
+				}
+
+				p.moves = append(p.moves, model.FragmentMove{
+					ObjectName:     meta.ObjectName,
+					SeqNum:         f.SeqNum,
+					FragmentID:     f.FragmentID,
+					FragmentSize:   f.FragmentSize,
+					Checksum:       f.Checksum,
+					SourceServerID: source.server.ID,
+					TargetServerID: target.server.ID,
+					Reason:         reason,
+				})
+				meta.Fragments[i].ServerID = target.server.ID
+				source.used -= f.FragmentSize
+				target.used += f.FragmentSize
+			}
+		}
+
+		if len(metas) < objectBatchSize {
+			return nil
+		}
+		after = metas[len(metas)-1].ObjectName
+	}
+
+	return nil
+}
+
+// pickTarget returns the target fitting the i-th fragment of the object that breaks the placement policy the least,
+// the least used one among equals, nil if there is none. With keepPlacement, targets adding placement violations
+// are not picked.
+func (r *Rebalancer) pickTarget(
+	p *movePlan, meta model.ObjectMeta, i int, targets []*serverUsage, keepPlacement bool,
+	fits func(t *serverUsage, size int64) bool,
+) *serverUsage {
+	f := meta.Fragments[i]
+	current := len(r.cfg.FailureDomain.placementViolations(meta, p.serversByID, 0))
+
+	var (
+		best           *serverUsage
+		bestViolations int
+	)
+	for _, t := range targets {
+		if !fits(t, f.FragmentSize) {
+			continue
+		}
+		if slices.ContainsFunc(meta.Fragments, func(o model.ObjectFragmentMeta) bool {
+			return o.ServerID == t.server.ID && (o.SeqNum == f.SeqNum || !r.cfg.AllowColocation)
+		}) {
+			continue
+		}
+
+		moved := meta
+		moved.Fragments = slices.Clone(meta.Fragments)
+		moved.Fragments[i].ServerID = t.server.ID
+		violations := len(r.cfg.FailureDomain.placementViolations(moved, p.serversByID, 0))
+		if keepPlacement && violations > current {
+			continue
+		}
+
+		if best == nil || violations < bestViolations ||
+			violations == bestViolations && t.utilization() < best.utilization() {
+			best, bestViolations = t, violations
+		}
+	}
+
+	return best
+}
+
+// movePlan collects the moves planned in a round.
+type movePlan struct {
+	serversByID map[uuid.UUID]model.Server
+	// failed are the fragment copies whose moves failed recently.
+	failed map[moveKey]bool
+	moves  []model.FragmentMove
+	limit  int
+}
+
+func (p *movePlan) full() bool {
+	return len(p.moves) >= p.limit
+}
+
+type serverUsage struct {
+	server model.Server
+	// used is the used space expected once the planned moves are done.
+	used int64
+}
+
+// utilization returns the share of capacity used, +Inf for servers with unknown capacity.
+func (u *serverUsage) utilization() float64 {
+	if u.server.Capacity <= 0 {
+		return math.Inf(1)
+	}
+
+	return float64(u.used) / float64(u.server.Capacity)
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+const (
+	defaultHeartbeatInterval = 10 * time.Second
+	defaultStaleAfter        = 30 * time.Second
+)
+
+type serverRegistryRepository interface {
+	UpsertServer(ctx context.Context, server model.Server) (model.Server, error)
+	TouchServer(ctx context.Context, serverID uuid.UUID, capacity int64) error
+	MarkStaleServers(ctx context.Context, heartbeatBefore time.Time) ([]model.Server, error)
+	ListFragmentObjects(ctx context.Context, serverID, fragmentID uuid.UUID) ([]string, error)
+	CreateRepairs(ctx context.Context, repairs []model.Repair) error
+}
+
+type RegistryConfig struct {
+	// HeartbeatInterval is the period storage servers are asked to send heartbeats at.
+	HeartbeatInterval time.Duration
+	// StaleAfter is the time without heartbeats after which a server is marked stale.
+	StaleAfter time.Duration
+}
+
+func (cfg *RegistryConfig) SetDefaults() {
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if cfg.StaleAfter <= 0 {
+		cfg.StaleAfter = max(defaultStaleAfter, 3*cfg.HeartbeatInterval)
+	}
+}
+
+// Registry keeps the list of storage servers up to date from their registrations and heartbeats.
+type Registry struct {
+	repo serverRegistryRepository
+	cfg  RegistryConfig
+}
+
+func NewRegistry(repo serverRegistryRepository, cfg RegistryConfig) *Registry {
+	cfg.SetDefaults()
+
+	return &Registry{
+		repo: repo,
+		cfg:  cfg,
+	}
+}
+
+// Register adds the server to the cluster, or updates the one registered with the same ID,
+// or with the same address if the server has no ID or an unknown one.
+func (r *Registry) Register(ctx context.Context, server model.Server) (model.Server, error) {
+	if server.Addr == "" {
+		return model.Server{}, model.ErrServerAddrEmpty
+	}
+
+	registered, err := r.repo.UpsertServer(ctx, server)
+	if err != nil {
+		return model.Server{}, fmt.Errorf("failed to register server: %w", err)
+	}
+
+	slog.Info("Server registered", "server_id", registered.ID, "addr", registered.Addr,
+		"capacity", registered.Capacity, "labels", registered.Labels)
+
+	return registered, nil
+}
+
+// Heartbeat records that the server is alive and queues repairs of the objects having fragments
+// the server found corrupt. It fails with model.ErrServerNotFound for unknown servers.
+func (r *Registry) Heartbeat(ctx context.Context, serverID uuid.UUID, capacity int64, corrupt []uuid.UUID) error {
+	if err := r.repo.TouchServer(ctx, serverID, capacity); err != nil {
+		return fmt.Errorf("failed to record heartbeat: %w", err)
+	}
+
+	var repairs []model.Repair
+	for _, fragmentID := range corrupt {
+		objectNames, err := r.repo.ListFragmentObjects(ctx, serverID, fragmentID)
+		if err != nil {
+			return fmt.Errorf("failed to find objects of corrupt fragment: %w", err)
+		}
+
+		slog.Warn("Server reported corrupt fragment", "server_id", serverID, "fragment_id", fragmentID,
+			"objects", objectNames)
+		for _, name := range objectNames {
+			repairs = append(repairs, model.Repair{ObjectName: name, Missing: 1})
+		}
+	}
+
+	if err := r.repo.CreateRepairs(ctx, repairs); err != nil {
+		return fmt.Errorf("failed to queue repairs: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Registry) HeartbeatInterval() time.Duration {
+	return r.cfg.HeartbeatInterval
+}
+
+// Run marks servers that stopped sending heartbeats as stale until the context is canceled.
+func (r *Registry) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stale, err := r.repo.MarkStaleServers(ctx, time.Now().Add(-r.cfg.StaleAfter))
+		if err != nil {
+			slog.Error("Failed to mark stale servers", "err", err)
+			continue
+		}
+
+		for _, s := range stale {
+			slog.Warn("Server marked stale", "server_id", s.ID, "addr", s.Addr, "last_heartbeat_at", s.LastHeartbeatAt)
+		}
+	}
+}
@@ -0,0 +1,582 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+const (
+	defaultRepairInterval        = time.Minute
+	defaultRepairDownAfter       = 15 * time.Minute
+	defaultRepairScanInterval    = 24 * time.Hour
+	defaultRepairStatParallelism = 8
+	defaultRepairMaxAttempts     = 5
+	defaultRepairFailedRetention = time.Hour
+
+	// repairerLockKey is the advisory lock key letting a single API server run the repairer.
+	repairerLockKey int64 = 0x5353_0002
+)
+
+type repairRepository interface {
+	GetServers(ctx context.Context) ([]model.Server, error)
+	GetObjectMeta(ctx context.Context, objectName string) (model.ObjectMeta, error)
+	ListObjectMeta(ctx context.Context, after string, limit int) ([]model.ObjectMeta, error)
+	ListServerObjects(ctx context.Context, serverID uuid.UUID, after string, limit int) ([]model.ObjectMeta, error)
+	SetFragmentServer(ctx context.Context, objectName string, fragment model.ObjectFragmentMeta, serverID uuid.UUID) error
+	CreateRepairs(ctx context.Context, repairs []model.Repair) error
+	GetRepairs(ctx context.Context) ([]model.Repair, error)
+	UpdateRepair(ctx context.Context, repair model.Repair) error
+	DeleteRepair(ctx context.Context, objectName string) error
+	TryLock(ctx context.Context, key int64) (func(), bool, error)
+	fragmentReferences
+}
+
+type serverHealthHistory interface {
+	serverHealth
+	Health() []model.ServerHealth
+}
+
+type RepairConfig struct {
+	// Interval is the period of repair rounds.
+	Interval time.Duration
+	// DownAfter is how long a server has to be down for the fragments on it to be considered lost.
+	DownAfter time.Duration
+	// ScanInterval is the period of asking servers whether they still have every fragment.
+	ScanInterval time.Duration
+	// StatParallelism is the maximum number of fragments checked at a time during a scan.
+	StatParallelism int
+	// MaxAttempts is the number of failed attempts after which a repair gives up.
+	MaxAttempts int
+	// FailedRetention is the time failed repairs are kept before the object may be queued again.
+	FailedRetention time.Duration
+}
+
+func (cfg *RepairConfig) SetDefaults() {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultRepairInterval
+	}
+	if cfg.DownAfter <= 0 {
+		cfg.DownAfter = defaultRepairDownAfter
+	}
+	if cfg.ScanInterval <= 0 {
+		cfg.ScanInterval = defaultRepairScanInterval
+	}
+	if cfg.StatParallelism <= 0 {
+		cfg.StatParallelism = defaultRepairStatParallelism
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultRepairMaxAttempts
+	}
+	if cfg.FailedRetention <= 0 {
+		cfg.FailedRetention = defaultRepairFailedRetention
+	}
+}
+
+// Repairer rebuilds fragment copies lost with their server, or missing from it, from the surviving replicas
+// or shards, and stores them on other servers.
+type Repairer struct {
+	objects *ObjectManager
+	storage fragmentStorage
+	repo    repairRepository
+	health  serverHealthHistory
+	cfg     RepairConfig
+	// lastScan is when all fragments were last checked.
+	lastScan time.Time
+}
+
+func NewRepairer(
+	objects *ObjectManager, storage fragmentStorage, repo repairRepository, health serverHealthHistory,
+	cfg RepairConfig,
+) *Repairer {
+	cfg.SetDefaults()
+
+	return &Repairer{
+		objects: objects,
+		storage: storage,
+		repo:    repo,
+		health:  health,
+		cfg:     cfg,
+	}
+}
+
+// Run repairs objects until the context is canceled. Only one API server sharing the database runs rounds
+// at a time. Repairs are queued in the database, so the queue survives restarts.
+func (r *Repairer) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		release, acquired, err := r.repo.TryLock(ctx, repairerLockKey)
+		if err != nil {
+			slog.Error("Failed to take repairer lock", "err", err)
+			continue
+		}
+		if !acquired {
+			continue
+		}
+
+		if err := r.round(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Repair round failed", "err", err)
+		}
+		release()
+	}
+}
+
+// round queues objects with lost fragments, then repairs the queued ones.
+func (r *Repairer) round(ctx context.Context) error {
+	servers, err := r.repo.GetServers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	serversByID := make(map[uuid.UUID]model.Server, len(servers))
+	for _, s := range servers {
+		serversByID[s.ID] = s
+	}
+
+	lostServers := make(map[uuid.UUID]bool)
+	for _, h := range r.health.Health() {
+		if h.State == model.HealthDown && time.Since(h.Since) >= r.cfg.DownAfter {
+			lostServers[h.Server.ID] = true
+		}
+	}
+
+	for serverID := range lostServers {
+		if err := r.queueServer(ctx, serversByID, lostServers, serverID); err != nil {
+			return err
+		}
+	}
+
+	if time.Since(r.lastScan) >= r.cfg.ScanInterval {
+		if err := r.scan(ctx, serversByID, lostServers); err != nil {
+			return err
+		}
+		r.lastScan = time.Now()
+	}
+
+	repairs, err := r.repo.GetRepairs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get repairs: %w", err)
+	}
+
+	for _, repair := range repairs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if repair.State == model.RepairFailed {
+			if time.Since(repair.UpdatedAt) >= r.cfg.FailedRetention {
+				r.deleteRepair(ctx, repair.ObjectName)
+			}
+			continue
+		}
+
+		r.repair(ctx, servers, serversByID, lostServers, repair)
+	}
+
+	return nil
+}
+
+// queueServer queues all objects having fragments on the lost server.
+func (r *Repairer) queueServer(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, lostServers map[uuid.UUID]bool, serverID uuid.UUID,
+) error {
+	after := ""
+	for {
+		metas, err := r.repo.ListServerObjects(ctx, serverID, after, objectBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list objects of server %s: %w", serverID, err)
+		}
+
+		repairs := make([]model.Repair, 0, len(metas))
+		for _, meta := range metas {
+			missing := 0
+			for _, f := range meta.Fragments {
+				if _, ok := serversByID[f.ServerID]; !ok || lostServers[f.ServerID] {
+					missing++
+				}
+			}
+			repairs = append(repairs, model.Repair{ObjectName: meta.ObjectName, Missing: missing})
+		}
+
+		if err := r.repo.CreateRepairs(ctx, repairs); err != nil {
+			return fmt.Errorf("failed to queue repairs: %w", err)
+		}
+
+		if len(metas) < objectBatchSize {
+			return nil
+		}
+		after = metas[len(metas)-1].ObjectName
+	}
+}
+
+// scan checks every fragment of every object and queues the objects with lost ones.
+func (r *Repairer) scan(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, lostServers map[uuid.UUID]bool,
+) error {
+	queued := 0
+
+	after := ""
+	for {
+		metas, err := r.repo.ListObjectMeta(ctx, after, objectBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		var repairs []model.Repair
+		for i, lost := range r.findLost(ctx, metas, serversByID, lostServers) {
+			if len(lost) > 0 {
+				repairs = append(repairs, model.Repair{ObjectName: metas[i].ObjectName, Missing: len(lost)})
+			}
+		}
+
+		if err := r.repo.CreateRepairs(ctx, repairs); err != nil {
+			return fmt.Errorf("failed to queue repairs: %w", err)
+		}
+		queued += len(repairs)
+
+		if len(metas) < objectBatchSize {
+			break
+		}
+		after = metas[len(metas)-1].ObjectName
+	}
+
+	slog.Info("Fragment scan finished", "objects_with_lost_fragments", queued)
+
+	return nil
+}
+
+// findLost returns the indexes of the lost fragments of every object: those on lost or unknown servers,
+// and those their server reports missing or of another size. Fragments on servers that can't be asked
+// are not considered lost.
+func (r *Repairer) findLost(
+	ctx context.Context, metas []model.ObjectMeta, serversByID map[uuid.UUID]model.Server,
+	lostServers map[uuid.UUID]bool,
+) []map[int]bool {
+	lost := make([]map[int]bool, len(metas))
+	for i := range lost {
+		lost[i] = make(map[int]bool)
+	}
+
+	var mu sync.Mutex
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(r.cfg.StatParallelism)
+
+	for i, meta := range metas {
+		for j, f := range meta.Fragments {
+			server, ok := serversByID[f.ServerID]
+			if !ok || lostServers[f.ServerID] {
+				lost[i][j] = true
+				continue
+			}
+			if r.health.State(f.ServerID) == model.HealthDown {
+				continue
+			}
+
+			g.Go(func() error {
+				info, err := r.storage.Stat(gctx, server.Addr, f.FragmentID)
+				if err != nil {
+					slog.Warn("Failed to check fragment",
+						"object", meta.ObjectName, "fragment_id", f.FragmentID, "server", server.Addr, "err", err)
+					return nil
+				}
+				// The size of fragments of objects stored before sizes were recorded is unknown until backfilled.
+				if !info.Exists || (!meta.SizeUnknown && info.Size != f.FragmentSize) {
+					mu.Lock()
+					lost[i][j] = true
+					mu.Unlock()
+				}
+				return nil
+			})
+		}
+	}
+	_ = g.Wait()
+
+	return lost
+}
+
+// repair rebuilds the lost fragments of the queued object one by one, recording progress in the queue.
+func (r *Repairer) repair(
+	ctx context.Context, servers []model.Server, serversByID map[uuid.UUID]model.Server,
+	lostServers map[uuid.UUID]bool, repair model.Repair,
+) {
+	log := slog.With("object", repair.ObjectName)
+
+	meta, err := r.repo.GetObjectMeta(ctx, repair.ObjectName)
+	if errors.Is(err, model.ErrObjectNotFound) {
+		r.deleteRepair(ctx, repair.ObjectName)
+		return
+	}
+	if err != nil {
+		r.fail(ctx, repair, err, false)
+		return
+	}
+
+	lost := r.findLost(ctx, []model.ObjectMeta{meta}, serversByID, lostServers)[0]
+	if len(lost) == 0 {
+		log.Info("Object has no lost fragments left")
+		r.deleteRepair(ctx, repair.ObjectName)
+		return
+	}
+	repair.Missing = repair.Repaired + len(lost)
+
+	if err := recoverable(meta, lost); err != nil {
+		r.fail(ctx, repair, err, true)
+		return
+	}
+
+	// Fragments are rebuilt to their recorded size, which the SizeBackfiller has yet to record.
+	if meta.SizeUnknown {
+		r.fail(ctx, repair, errors.New("object size not backfilled yet"), false)
+		return
+	}
+
+	indexes := make([]int, 0, len(lost))
+	for i := range lost {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	for _, i := range indexes {
+		lostFragment := meta.Fragments[i]
+
+		fragment, err := r.objects.rebuildFragment(ctx, servers, serversByID, meta, i, lost)
+		if err == nil {
+			err = r.repo.SetFragmentServer(ctx, meta.ObjectName, lostFragment, fragment.ServerID)
+			if errors.Is(err, model.ErrFragmentChanged) {
+				// The object was deleted or overwritten meanwhile, so the rebuilt copy is not needed.
+				log.Info("Repair abandoned, object changed")
+				target := serversByID[fragment.ServerID]
+				if err := deleteUnreferenced(ctx, r.storage, r.repo, target, fragment.FragmentID); err != nil {
+					log.Warn("Failed to delete rebuilt fragment", "err", err)
+				}
+				r.deleteRepair(ctx, repair.ObjectName)
+				return
+			}
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				r.fail(ctx, repair, fmt.Errorf("fragment %d: %w", lostFragment.SeqNum, err), false)
+			}
+			return
+		}
+
+		log.Info("Fragment rebuilt", "seq_num", fragment.SeqNum, "replica", fragment.Replica,
+			"lost_server", lostFragment.ServerID, "server", fragment.ServerID)
+		fragmentRepairs.Add(1)
+
+		meta.Fragments[i] = fragment
+		delete(lost, i)
+		repair.Repaired++
+		if err := r.repo.UpdateRepair(ctx, repair); err != nil {
+			log.Error("Failed to save repair", "err", err)
+		}
+	}
+
+	log.Info("Object repaired", "fragments", repair.Repaired)
+	r.deleteRepair(ctx, repair.ObjectName)
+}
+
+// recoverable returns an error if the object lost more fragments than its redundancy allows to rebuild.
+func recoverable(meta model.ObjectMeta, lost map[int]bool) error {
+	if meta.Layout.Scheme == model.LayoutErasure {
+		if len(lost) > meta.Layout.ParityShards {
+			return fmt.Errorf("%d shards lost, %d parity shards: %w",
+				len(lost), meta.Layout.ParityShards, model.ErrNotEnoughShards)
+		}
+		return nil
+	}
+
+	surviving := make(map[int]bool)
+	for i, f := range meta.Fragments {
+		if !lost[i] {
+			surviving[f.SeqNum] = true
+		}
+	}
+	for i, f := range meta.Fragments {
+		if lost[i] && !surviving[f.SeqNum] {
+			return fmt.Errorf("fragment %d: %w", f.SeqNum, model.ErrFragmentLost)
+		}
+	}
+
+	return nil
+}
+
+// fail records the failed attempt, giving the repair up after MaxAttempts attempts, or at once if final is set.
+func (r *Repairer) fail(ctx context.Context, repair model.Repair, err error, final bool) {
+	repair.Attempts++
+	repair.LastError = err.Error()
+
+	log := slog.With("object", repair.ObjectName, "attempts", repair.Attempts, "err", err)
+	if final || repair.Attempts >= r.cfg.MaxAttempts {
+		repair.State = model.RepairFailed
+		log.Error("Repair failed")
+	} else {
+		log.Warn("Repair attempt failed")
+	}
+
+	if err := r.repo.UpdateRepair(ctx, repair); err != nil {
+		log.Error("Failed to save repair", "err", err)
+	}
+}
+
+func (r *Repairer) deleteRepair(ctx context.Context, objectName string) {
+	if err := r.repo.DeleteRepair(ctx, objectName); err != nil {
+		slog.Error("Failed to delete repair", "object", objectName, "err", err)
+	}
+}
+
+// rebuildFragment restores the i-th fragment of the object from its other replicas, or from the other shards
+// of an erasure-coded object, and stores it on another server. Fragments in lost are not read.
+// It returns the fragment as stored on its new server.
+func (m *ObjectManager) rebuildFragment(
+	ctx context.Context, servers []model.Server, serversByID map[uuid.UUID]model.Server,
+	meta model.ObjectMeta, i int, lost map[int]bool,
+) (model.ObjectFragmentMeta, error) {
+	f := meta.Fragments[i]
+
+	targets := m.repairTargets(servers, serversByID, meta, i, lost)
+	if len(targets) == 0 {
+		return f, fmt.Errorf("no server to store the fragment on: %w", model.ErrNotEnoughServers)
+	}
+
+	s, err := newSpool(m.cfg.SpoolDir)
+	if err != nil {
+		return f, err
+	}
+	defer closeSpool(s)
+
+	verifier := newChecksumWriter(s)
+	if err := m.restoreFragment(ctx, serversByID, meta, i, lost, verifier); err != nil {
+		return f, err
+	}
+	if f.Checksum != "" {
+		if err := verifier.Verify(f.Checksum); err != nil {
+			return f, fmt.Errorf("rebuilt fragment: %w", err)
+		}
+	}
+
+	assigned := []model.Server{targets[0]}
+	checksum, err := m.storeReplicas(ctx, assigned, newServerPool(targets[1:], true), f.FragmentID, s, nil)
+	if err != nil {
+		return f, fmt.Errorf("failed to store rebuilt fragment: %w", err)
+	}
+	if f.Checksum != "" && checksum != f.Checksum {
+		return f, fmt.Errorf("stored fragment on '%s': expected %s, got %s: %w",
+			assigned[0].Addr, f.Checksum, checksum, model.ErrChecksumMismatch)
+	}
+
+	f.ServerID = assigned[0].ID
+
+	return f, nil
+}
+
+// restoreFragment writes the whole i-th fragment of the object to dst, read from another replica
+// or computed from other shards.
+func (m *ObjectManager) restoreFragment(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, meta model.ObjectMeta, i int, lost map[int]bool,
+	dst io.Writer,
+) error {
+	f := meta.Fragments[i]
+
+	if meta.Layout.Scheme == model.LayoutErasure {
+		groups := meta.ReplicaGroups()
+		if len(groups) != meta.Layout.DataShards+meta.Layout.ParityShards {
+			return fmt.Errorf("object has %d of %d shards: %w",
+				len(groups), meta.Layout.DataShards+meta.Layout.ParityShards, model.ErrNotEnoughShards)
+		}
+
+		shards := make([]model.ObjectFragmentMeta, 0, len(groups))
+		for _, g := range groups {
+			shards = append(shards, g[0])
+		}
+
+		lostShards := make(map[int]bool, len(lost))
+		for j := range lost {
+			lostShards[meta.Fragments[j].SeqNum] = true
+		}
+
+		return m.restoreShard(ctx, serversByID, meta.Layout, shards, f.SeqNum, lostShards, 0, f.FragmentSize, dst)
+	}
+
+	var replicas []model.ObjectFragmentMeta
+	for j, r := range meta.Fragments {
+		if j != i && !lost[j] && r.SeqNum == f.SeqNum {
+			replicas = append(replicas, r)
+		}
+	}
+	if len(replicas) == 0 {
+		return fmt.Errorf("fragment %d: %w", f.SeqNum, model.ErrFragmentLost)
+	}
+
+	return m.retrieveReplicas(ctx, serversByID, replicas, 0, f.FragmentSize, dst)
+}
+
+// repairTargets returns the servers a rebuilt copy of the i-th fragment of the object may be stored on,
+// the best first: those keeping the fragment and the object spread across failure domains, healthy ones
+// before degraded ones, then in the order preferred by Config.Placement. Servers holding another copy
+// of the fragment are left out, as are servers holding any fragment of the object unless colocation is allowed.
+func (m *ObjectManager) repairTargets(
+	servers []model.Server, serversByID map[uuid.UUID]model.Server, meta model.ObjectMeta, i int, lost map[int]bool,
+) []model.Server {
+	f := meta.Fragments[i]
+
+	holding := map[uuid.UUID]bool{f.ServerID: true}
+	fragmentDomains := make(map[string]int)
+	objectDomains := make(map[string]int)
+	for j, o := range meta.Fragments {
+		if lost[j] {
+			continue
+		}
+		if o.SeqNum == f.SeqNum || !m.cfg.AllowColocation {
+			holding[o.ServerID] = true
+		}
+
+		server, ok := serversByID[o.ServerID]
+		if !ok {
+			server = model.Server{ID: o.ServerID}
+		}
+		domain := m.cfg.FailureDomain.domainOf(server)
+		objectDomains[domain]++
+		if o.SeqNum == f.SeqNum {
+			fragmentDomains[domain]++
+		}
+	}
+
+	candidates := slices.DeleteFunc(m.placementCandidates(servers), func(s model.Server) bool {
+		return holding[s.ID]
+	})
+	ranked := m.cfg.Placement.Rank(fragmentKey(meta.ObjectName, f.SeqNum), candidates)
+
+	score := func(s model.Server) []int {
+		domain := m.cfg.FailureDomain.domainOf(s)
+		degraded := 0
+		if m.health.State(s.ID) == model.HealthDegraded {
+			degraded = 1
+		}
+		return []int{fragmentDomains[domain], objectDomains[domain], degraded}
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return slices.Compare(score(ranked[a]), score(ranked[b])) < 0
+	})
+
+	return ranked
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+// placedFunc is called with every server before a fragment copy is stored on it.
+type placedFunc func(ctx context.Context, replica int, server model.Server) error
+
+// storeReplicas uploads the spooled fragment to all servers in parallel and returns the fragment checksum.
+// A server still failing after retries is replaced in servers by one from the pool.
+// Running out of servers aborts the other uploads.
+// If placed is set, it is called with every server before storing a copy on it.
+func (m *ObjectManager) storeReplicas(
+	ctx context.Context, servers []model.Server, pool *serverPool, fragmentID uuid.UUID, s *spool, placed placedFunc,
+) (string, error) {
+	checksums := make([]string, len(servers))
+
+	g, gctx := errgroup.WithContext(ctx)
+	for i, server := range servers {
+		g.Go(func() error {
+			for {
+				if placed != nil {
+					if err := placed(gctx, i, server); err != nil {
+						return err
+					}
+				}
+
+				err := m.retry(gctx, "store", server.Addr, func(ctx context.Context) error {
+					checksum, err := m.objectStorage.Store(ctx, server.Addr, fragmentID, s.Reader(), s.size)
+					checksums[i] = checksum
+					return err
+				})
+				if err == nil {
+					return nil
+				}
+				if gctx.Err() != nil {
+					return fmt.Errorf("server '%s': %w", server.Addr, err)
+				}
+
+				replacement, replaceErr := pool.replace(servers, i)
+				if replaceErr != nil {
+					return fmt.Errorf("server '%s': %w", server.Addr, errors.Join(err, replaceErr))
+				}
+				slog.Warn("Storing fragment on another server",
+					"fragment_id", fragmentID, "failed_server", server.Addr, "server", replacement.Addr, "err", err)
+				server = replacement
+			}
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return "", err
+	}
+
+	return checksums[0], nil
+}
+
+// retrieveReplicas writes length bytes of the fragment starting at offset to dst,
+// switching to the next replica when one fails. A fragment read in full is verified before it is written to dst,
+// so a replica returning corrupted data is replaced by the next one.
+func (m *ObjectManager) retrieveReplicas(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, replicas []model.ObjectFragmentMeta,
+	offset, length int64, dst io.Writer,
+) error {
+	f := replicas[0]
+	if offset == 0 && length == f.FragmentSize && f.Checksum != "" {
+		if f.FragmentSize <= m.cfg.FragmentBufferSize {
+			return m.retrieveBufferedReplicas(ctx, serversByID, replicas, dst)
+		}
+		return m.retrieveSpooledReplicas(ctx, serversByID, replicas, dst)
+	}
+
+	// Data already sent to dst can't be taken back: a replica failing midway is replaced
+	// by the next one reading from where the previous one stopped.
+	counter := &countingWriter{dst: dst}
+	var errs []error
+	for _, r := range replicas {
+		if counter.n == length {
+			break
+		}
+
+		server, ok := serversByID[r.ServerID]
+		if !ok {
+			errs = append(errs, fmt.Errorf("server '%s' not found: %w", r.ServerID, model.ErrServerNotFound))
+			continue
+		}
+
+		err := m.retry(ctx, "retrieve", server.Addr, func(ctx context.Context) error {
+			start := counter.n
+			err := m.objectStorage.Retrieve(ctx, server.Addr, r.FragmentID, offset+start, length-start, counter)
+			if err == nil && counter.n != length {
+				err = fmt.Errorf("got %d bytes of %d: %w", counter.n-start, length-start, io.ErrUnexpectedEOF)
+			}
+			return err
+		})
+		if err != nil {
+			slog.Warn("Failed to retrieve fragment replica",
+				"fragment_id", r.FragmentID, "replica", r.Replica, "server", server.Addr, "err", err)
+			errs = append(errs, fmt.Errorf("replica %d: %w", r.Replica, err))
+		}
+	}
+
+	if counter.n != length {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// retrieveBufferedReplicas reads the whole fragment into memory and verifies it before writing it to dst.
+func (m *ObjectManager) retrieveBufferedReplicas(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, replicas []model.ObjectFragmentMeta, dst io.Writer,
+) error {
+	var buf bytes.Buffer
+	buf.Grow(int(replicas[0].FragmentSize))
+
+	err := m.fetchVerifiedReplica(ctx, serversByID, replicas, &buf, func() error {
+		buf.Reset()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dst.Write(buf.Bytes())
+	return err
+}
+
+// retrieveSpooledReplicas reads the whole fragment into a spool file and verifies it before writing it to dst,
+// for fragments too large to be buffered in memory.
+func (m *ObjectManager) retrieveSpooledReplicas(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, replicas []model.ObjectFragmentMeta, dst io.Writer,
+) error {
+	s, err := newSpool(m.cfg.SpoolDir)
+	if err != nil {
+		return err
+	}
+	defer closeSpool(s)
+
+	if err := m.fetchVerifiedReplica(ctx, serversByID, replicas, s, s.Reset); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, s.Reader())
+	return err
+}
+
+// fetchVerifiedReplica writes the whole fragment to buf from the first replica matching its checksum.
+// The reset function discards what buf got from a replica before trying again.
+func (m *ObjectManager) fetchVerifiedReplica(
+	ctx context.Context, serversByID map[uuid.UUID]model.Server, replicas []model.ObjectFragmentMeta,
+	buf io.Writer, reset func() error,
+) error {
+	var errs []error
+	for _, r := range replicas {
+		server, ok := serversByID[r.ServerID]
+		if !ok {
+			errs = append(errs, fmt.Errorf("server '%s' not found: %w", r.ServerID, model.ErrServerNotFound))
+			continue
+		}
+
+		err := m.retry(ctx, "retrieve", server.Addr, func(ctx context.Context) error {
+			if err := reset(); err != nil {
+				return err
+			}
+			verifier := newChecksumWriter(buf)
+			if err := m.objectStorage.Retrieve(ctx, server.Addr, r.FragmentID, 0, r.FragmentSize, verifier); err != nil {
+				return err
+			}
+			return verifier.Verify(r.Checksum)
+		})
+		if err != nil {
+			slog.Warn("Failed to retrieve fragment replica",
+				"fragment_id", r.FragmentID, "replica", r.Replica, "server", server.Addr, "err", err)
+			errs = append(errs, fmt.Errorf("replica %d: %w", r.Replica, err))
+			continue
+		}
+
+		return nil
+	}
+
+	return errors.Join(errs...)
+}
+
+type countingReader struct {
+	src io.Reader
+	n   int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	dst io.Writer
+	n   int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.dst.Write(p)
+	w.n += int64(n)
+	return n, err
+}
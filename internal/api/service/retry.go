@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/status"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+// retry calls transfer until it succeeds or fails with an error the retry policy doesn't allow to retry,
+// waiting an exponentially growing, randomized delay between attempts.
+func (m *ObjectManager) retry(
+	ctx context.Context, operation, serverAddr string, transfer func(ctx context.Context) error,
+) error {
+	policy := m.cfg.Retry
+
+	var deadline time.Time
+	if policy.Budget > 0 {
+		deadline = time.Now().Add(policy.Budget)
+	}
+
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := transfer(ctx)
+		if err == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || !m.isRetryable(err) {
+			return err
+		}
+
+		// Equal jitter: half of the delay is fixed, the other half random.
+		delay := backoff/2 + rand.N(backoff/2+1)
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+
+		slog.Warn("Retrying fragment transfer", "operation", operation, "server", serverAddr,
+			"attempt", attempt, "delay", delay, "err", err)
+		fragmentRetries.Add(operation, 1)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+
+		backoff = min(backoff*2, policy.MaxBackoff)
+	}
+}
+
+func (m *ObjectManager) isRetryable(err error) bool {
+	return slices.Contains(m.cfg.Retry.RetryableCodes, status.Code(err))
+}
+
+// serverPool hands out replacements for servers failing to store fragments of an object,
+// in the order of preference, skipping servers that already failed during the upload.
+// Servers of an exclusive pool are handed out at most once, to keep every fragment on a distinct server.
+type serverPool struct {
+	mu        sync.Mutex
+	servers   []model.Server
+	exclusive bool
+	failed    map[uuid.UUID]bool
+}
+
+func newServerPool(servers []model.Server, exclusive bool) *serverPool {
+	return &serverPool{
+		servers:   slices.Clone(servers),
+		exclusive: exclusive,
+		failed:    make(map[uuid.UUID]bool),
+	}
+}
+
+// replace marks assigned[i] as failed and replaces it by the most preferred server
+// neither failed nor already in assigned.
+func (p *serverPool) replace(assigned []model.Server, i int) (model.Server, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failed[assigned[i].ID] = true
+
+	for j, s := range p.servers {
+		if p.failed[s.ID] || slices.ContainsFunc(assigned, func(a model.Server) bool { return a.ID == s.ID }) {
+			continue
+		}
+
+		if p.exclusive {
+			p.servers = slices.Delete(p.servers, j, j+1)
+		}
+
+		fragmentFailovers.Add(1)
+		assigned[i] = s
+		return s, nil
+	}
+
+	return model.Server{}, fmt.Errorf("no server to replace '%s': %w", assigned[i].Addr, model.ErrNotEnoughServers)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// spool is a temporary file holding fragment data until it is uploaded, or verified on download.
+type spool struct {
+	file *os.File
+	size int64
+}
+
+func newSpool(dir string) (*spool, error) {
+	file, err := os.CreateTemp(dir, "fragment-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	return &spool{file: file}, nil
+}
+
+func (s *spool) Write(p []byte) (int, error) {
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+func (s *spool) ReadAt(p []byte, off int64) (int, error) {
+	return s.file.ReadAt(p, off)
+}
+
+// Reset discards the spooled data.
+func (s *spool) Reset() error {
+	if err := s.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate spool file: %w", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spool file: %w", err)
+	}
+	s.size = 0
+	return nil
+}
+
+// Reader returns a reader of the whole spooled data, independent of other readers.
+func (s *spool) Reader() io.Reader {
+	return io.NewSectionReader(s.file, 0, s.size)
+}
+
+func (s *spool) Close() error {
+	return errors.Join(s.file.Close(), os.Remove(s.file.Name()))
+}
+
+// spoolFragment copies exactly size bytes from src into a new spool.
+func spoolFragment(dir string, src io.Reader, size int64) (*spool, error) {
+	s, err := newSpool(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := io.Copy(s, io.LimitReader(src, size))
+	if err == nil && n != size {
+		err = fmt.Errorf("expected %d bytes, read %d: %w", size, n, io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to spool fragment: %w", err), s.Close())
+	}
+
+	return s, nil
+}
+
+// closeSpool releases the spool, logging failures as there is nothing else to do about them.
+func closeSpool(s *spool) {
+	if err := s.Close(); err != nil {
+		slog.Error("Failed to remove spool file", "err", err)
+	}
+}
+
+// zeroReader is an endless source of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
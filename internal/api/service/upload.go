@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+const (
+	defaultUploadCleanupInterval = 5 * time.Minute
+	defaultUploadAbandonAfter    = time.Hour
+
+	// uploadTouchInterval is the period running uploads refresh their journal at.
+	uploadTouchInterval = time.Minute
+
+	// uploadRollbackTimeout bounds deleting the fragments of a failed upload, which outlives the request.
+	uploadRollbackTimeout = time.Minute
+
+	// uploadCleanerLockKey is the advisory lock key letting a single API server clean up abandoned uploads.
+	uploadCleanerLockKey int64 = 0x5353_0004
+)
+
+// uploadDiscarder is what discarding a pending upload takes.
+type uploadDiscarder interface {
+	GetServers(ctx context.Context) ([]model.Server, error)
+	DeletePendingUpload(ctx context.Context, uploadID uuid.UUID) (model.PendingUpload, error)
+	fragmentReferences
+}
+
+type uploadJournal interface {
+	CreatePendingUpload(ctx context.Context, upload model.PendingUpload) (model.PendingUpload, error)
+	AddPendingFragments(ctx context.Context, uploadID uuid.UUID, fragments []model.ObjectFragmentMeta) error
+	TouchPendingUpload(ctx context.Context, uploadID uuid.UUID) error
+	CommitUpload(ctx context.Context, uploadID uuid.UUID, meta model.ObjectMeta) error
+	uploadDiscarder
+}
+
+type uploadCleanupRepository interface {
+	ListStalePendingUploads(ctx context.Context, updatedBefore time.Time, limit int) ([]model.PendingUpload, error)
+	TryLock(ctx context.Context, key int64) (func(), bool, error)
+	uploadDiscarder
+}
+
+// journalFragment returns a callback recording the copies of the fragment in the upload journal before they are
+// stored, so that a copy the storage server commits while the upload is given up on is rolled back as well.
+func (m *ObjectManager) journalFragment(uploadID uuid.UUID, seqNum int, fragmentID uuid.UUID, size int64) placedFunc {
+	return func(ctx context.Context, replica int, server model.Server) error {
+		err := m.metaRepo.AddPendingFragments(ctx, uploadID, []model.ObjectFragmentMeta{{
+			SeqNum:       seqNum,
+			Replica:      replica,
+			ServerID:     server.ID,
+			FragmentID:   fragmentID,
+			FragmentSize: size,
+		}})
+		if err != nil {
+			return fmt.Errorf("failed to journal fragment %d: %w", seqNum, err)
+		}
+		return nil
+	}
+}
+
+// keepUploadAlive refreshes the upload journal every uploadTouchInterval until the returned function is called,
+// so the UploadCleaner doesn't take an upload still making progress for an abandoned one.
+func (m *ObjectManager) keepUploadAlive(ctx context.Context, uploadID uuid.UUID) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(uploadTouchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := m.metaRepo.TouchPendingUpload(ctx, uploadID); err != nil && ctx.Err() == nil {
+				slog.Warn("Failed to refresh upload journal", "upload_id", uploadID, "err", err)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// rollbackUpload deletes the fragment copies stored for a failed upload. Whatever it fails to delete is left
+// to the UploadCleaner or garbage collection.
+func (m *ObjectManager) rollbackUpload(ctx context.Context, uploadID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), uploadRollbackTimeout)
+	defer cancel()
+
+	if err := discardUpload(ctx, m.objectStorage, m.metaRepo, uploadID); err != nil {
+		slog.Error("Failed to roll back upload", "upload_id", uploadID, "err", err)
+	}
+}
+
+// discardUpload removes the upload from the journal and deletes the fragment copies stored for it,
+// unless an object references them. Uploads no longer journaled are left alone.
+func discardUpload(ctx context.Context, storage objectStorage, repo uploadDiscarder, uploadID uuid.UUID) error {
+	servers, err := repo.GetServers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get servers: %w", err)
+	}
+
+	upload, err := repo.DeletePendingUpload(ctx, uploadID)
+	if errors.Is(err, model.ErrUploadAbandoned) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete pending upload: %w", err)
+	}
+
+	serversByID := make(map[uuid.UUID]model.Server, len(servers))
+	for _, s := range servers {
+		serversByID[s.ID] = s
+	}
+
+	// The upload is no longer journaled, so fragments failing to be deleted are found orphaned by garbage collection.
+	var errs []error
+	for _, f := range upload.Fragments {
+		server, ok := serversByID[f.ServerID]
+		if !ok {
+			continue
+		}
+		if err := deleteUnreferenced(ctx, storage, repo, server, f.FragmentID); err != nil {
+			errs = append(errs, fmt.Errorf("fragment %d on '%s': %w", f.SeqNum, server.Addr, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkNoTrailingData fails with model.ErrSizeMismatch if src holds more data than the declared size.
+func checkNoTrailingData(src io.Reader) error {
+	var b [1]byte
+	n, err := io.ReadFull(src, b[:])
+	if n > 0 {
+		return fmt.Errorf("more data than declared: %w", model.ErrSizeMismatch)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read data: %w", err)
+	}
+
+	return nil
+}
+
+// verifyStoredSize checks that the declared size was read from the client and the data fragments hold all of it.
+func verifyStoredSize(meta model.ObjectMeta, read int64) error {
+	if read != meta.Size {
+		return fmt.Errorf("declared %d bytes, read %d: %w", meta.Size, read, model.ErrSizeMismatch)
+	}
+
+	var stored int64
+	for _, f := range meta.Fragments {
+		if f.Replica == 0 && (meta.Layout.Scheme != model.LayoutErasure || f.SeqNum < meta.Layout.DataShards) {
+			stored += f.FragmentSize
+		}
+	}
+
+	// Erasure-coded data shards are padded up to a multiple of the number of data shards.
+	padding := int64(0)
+	if meta.Layout.Scheme == model.LayoutErasure {
+		padding = int64(meta.Layout.DataShards) - 1
+	}
+	if stored < meta.Size || stored > meta.Size+padding {
+		return fmt.Errorf("declared %d bytes, stored %d: %w", meta.Size, stored, model.ErrSizeMismatch)
+	}
+
+	return nil
+}
+
+type UploadCleanupConfig struct {
+	// Interval is the period of looking for abandoned uploads.
+	Interval time.Duration
+	// AbandonAfter is how long an upload may go without refreshing its journal before it is considered abandoned.
+	// Running uploads refresh it every minute, so it is at least a few minutes.
+	AbandonAfter time.Duration
+}
+
+func (cfg *UploadCleanupConfig) SetDefaults() {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultUploadCleanupInterval
+	}
+	if cfg.AbandonAfter <= 0 {
+		cfg.AbandonAfter = defaultUploadAbandonAfter
+	}
+	cfg.AbandonAfter = max(cfg.AbandonAfter, 3*uploadTouchInterval)
+}
+
+// UploadCleaner deletes the fragments of uploads abandoned midway, such as by an API server crash.
+// An upload it cleans up while still running fails to commit.
+type UploadCleaner struct {
+	storage objectStorage
+	repo    uploadCleanupRepository
+	cfg     UploadCleanupConfig
+}
+
+func NewUploadCleaner(storage objectStorage, repo uploadCleanupRepository, cfg UploadCleanupConfig) *UploadCleaner {
+	cfg.SetDefaults()
+
+	return &UploadCleaner{
+		storage: storage,
+		repo:    repo,
+		cfg:     cfg,
+	}
+}
+
+// Run cleans up abandoned uploads until the context is canceled. Only one API server sharing the database
+// does it at a time.
+func (c *UploadCleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		release, acquired, err := c.repo.TryLock(ctx, uploadCleanerLockKey)
+		if err != nil {
+			slog.Error("Failed to take upload cleaner lock", "err", err)
+			continue
+		}
+		if !acquired {
+			continue
+		}
+
+		if err := c.cleanup(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Upload cleanup failed", "err", err)
+		}
+		release()
+	}
+}
+
+// cleanup discards up to objectBatchSize abandoned uploads, the oldest first; the rest wait for the next round.
+func (c *UploadCleaner) cleanup(ctx context.Context) error {
+	uploads, err := c.repo.ListStalePendingUploads(ctx, time.Now().Add(-c.cfg.AbandonAfter), objectBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to list pending uploads: %w", err)
+	}
+
+	for _, upload := range uploads {
+		slog.Warn("Cleaning up abandoned upload", "upload_id", upload.ID, "object", upload.ObjectName,
+			"fragments", len(upload.Fragments), "updated_at", upload.UpdatedAt)
+		if err := discardUpload(ctx, c.storage, c.repo, upload.ID); err != nil {
+			slog.Error("Failed to clean up abandoned upload", "upload_id", upload.ID, "err", err)
+		}
+	}
+
+	return nil
+}
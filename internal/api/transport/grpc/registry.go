@@ -0,0 +1,87 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+	"github.com/ssimpl/simple-storage/pkg/registry"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+type serverRegistry interface {
+	Register(ctx context.Context, server model.Server) (model.Server, error)
+	Heartbeat(ctx context.Context, serverID uuid.UUID, capacity int64, corrupt []uuid.UUID) error
+	HeartbeatInterval() time.Duration
+}
+
+type RegistryServer struct {
+	registry.UnimplementedRegistryServer
+
+	registry serverRegistry
+}
+
+func NewRegistryServer(registry serverRegistry) *RegistryServer {
+	return &RegistryServer{
+		registry: registry,
+	}
+}
+
+func (s *RegistryServer) Register(
+	ctx context.Context, req *registry.RegisterRequest,
+) (*registry.RegisterResponse, error) {
+	// Servers registering for the first time have no ID yet.
+	var serverID uuid.UUID
+	if req.GetServerId() != "" {
+		var err error
+		if serverID, err = uuid.Parse(req.GetServerId()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid server id: %v", err)
+		}
+	}
+
+	server, err := s.registry.Register(ctx, model.Server{
+		ID:       serverID,
+		Addr:     req.GetAddr(),
+		Capacity: req.GetCapacity(),
+		Labels:   req.GetLabels(),
+	})
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	return &registry.RegisterResponse{
+		ServerId:          server.ID.String(),
+		HeartbeatInterval: durationpb.New(s.registry.HeartbeatInterval()),
+	}, nil
+}
+
+func (s *RegistryServer) Heartbeat(
+	ctx context.Context, req *registry.HeartbeatRequest,
+) (*registry.HeartbeatResponse, error) {
+	serverID, err := uuid.Parse(req.GetServerId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid server id: %v", err)
+	}
+
+	// A malformed ID must not keep the server from reporting the others and staying alive.
+	corrupt := make([]uuid.UUID, 0, len(req.GetCorruptFragmentIds()))
+	for _, id := range req.GetCorruptFragmentIds() {
+		fragmentID, err := uuid.Parse(id)
+		if err != nil {
+			slog.Warn("Ignoring invalid corrupt fragment id", "server_id", serverID, "fragment_id", id)
+			continue
+		}
+		corrupt = append(corrupt, fragmentID)
+	}
+
+	if err := s.registry.Heartbeat(ctx, serverID, req.GetCapacity(), corrupt); err != nil {
+		return nil, toStatusError(err)
+	}
+
+	return &registry.HeartbeatResponse{}, nil
+}
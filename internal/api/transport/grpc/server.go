@@ -0,0 +1,85 @@
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ssimpl/simple-storage/pkg/registry"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+const connectionTimeout = time.Second * 10
+
+type Server struct {
+	addr   string
+	server *grpc.Server
+}
+
+// NewServer creates the registry server. Calls must carry the token as a bearer token in the
+// "authorization" metadata; with no token configured all of them are refused.
+func NewServer(addr, token string, registrySrv registry.RegistryServer) *Server {
+	auth := tokenAuth(token)
+
+	server := grpc.NewServer(
+		grpc.ConnectionTimeout(connectionTimeout),
+		grpc.UnaryInterceptor(func(
+			ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+		) (any, error) {
+			if err := auth.check(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(
+			srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler,
+		) error {
+			if err := auth.check(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+
+	registry.RegisterRegistryServer(server, registrySrv)
+	reflection.Register(server)
+
+	return &Server{
+		addr:   addr,
+		server: server,
+	}
+}
+
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	return s.server.Serve(listener)
+}
+
+func (s *Server) Stop() {
+	s.server.GracefulStop()
+}
+
+// tokenAuth is the shared token storage servers authenticate to the registry with.
+type tokenAuth string
+
+func (t tokenAuth) check(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "invalid registry token")
+}
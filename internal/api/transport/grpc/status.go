@@ -0,0 +1,32 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatusError converts an error to a gRPC status error, so storage servers can tell
+// bad requests and unknown servers from transient failures.
+func toStatusError(err error) error {
+	code := codes.Internal
+
+	switch {
+	case errors.Is(err, model.ErrServerAddrEmpty):
+		code = codes.InvalidArgument
+	case errors.Is(err, model.ErrServerNotFound):
+		code = codes.NotFound
+	case errors.Is(err, model.ErrServerAddrTaken):
+		code = codes.AlreadyExists
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,570 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ssimpl/simple-storage/internal/api/model"
+)
+
+const contentTypeJSON = "application/json"
+
+const (
+	defaultViolationsLimit = 100
+	maxViolationsLimit     = 1000
+)
+
+type healthView interface {
+	Health() []model.ServerHealth
+}
+
+type clusterManager interface {
+	ListServers(ctx context.Context) ([]model.ServerOverview, error)
+	AddServer(ctx context.Context, server model.Server) (model.Server, error)
+	RemoveServer(ctx context.Context, serverID uuid.UUID) error
+	SetServerStatus(ctx context.Context, serverID uuid.UUID, status model.ServerStatus) error
+	DrainProgress(ctx context.Context, serverID uuid.UUID) (model.DrainProgress, error)
+	Stats(ctx context.Context) (model.ClusterStats, error)
+	PlacementViolations(ctx context.Context, after string, limit int) ([]model.PlacementViolation, string, error)
+	Moves(ctx context.Context) ([]model.FragmentMove, error)
+	Repairs(ctx context.Context) ([]model.Repair, error)
+}
+
+type garbageCollector interface {
+	Collect(ctx context.Context, dryRun bool) (model.GCReport, error)
+	LastReport() (model.GCReport, bool)
+}
+
+// AdminHandler serves the cluster management API under /admin/ and the metrics at /debug/vars.
+// Requests must carry the configured token as a bearer token; with no token configured all of them are refused.
+type AdminHandler struct {
+	token   string
+	health  healthView
+	cluster clusterManager
+	gc      garbageCollector
+	mux     *http.ServeMux
+}
+
+func NewAdminHandler(token string, health healthView, cluster clusterManager, gc garbageCollector) *AdminHandler {
+	h := &AdminHandler{
+		token:   token,
+		health:  health,
+		cluster: cluster,
+		gc:      gc,
+		mux:     http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("GET /admin/health", h.getHealth)
+	h.mux.HandleFunc("GET /admin/cluster", h.getCluster)
+	h.mux.HandleFunc("GET /admin/placement/violations", h.listPlacementViolations)
+	h.mux.HandleFunc("GET /admin/moves", h.listMoves)
+	h.mux.HandleFunc("GET /admin/repairs", h.listRepairs)
+	h.mux.HandleFunc("GET /admin/gc", h.getGCReport)
+	h.mux.HandleFunc("POST /admin/gc", h.collectGarbage)
+	h.mux.HandleFunc("GET /admin/servers", h.listServers)
+	h.mux.HandleFunc("POST /admin/servers", h.addServer)
+	h.mux.HandleFunc("DELETE /admin/servers/{id}", h.removeServer)
+	h.mux.HandleFunc("POST /admin/servers/{id}/cordon", h.setServerStatus(model.ServerCordoned))
+	h.mux.HandleFunc("POST /admin/servers/{id}/uncordon", h.setServerStatus(model.ServerActive))
+	h.mux.HandleFunc("POST /admin/servers/{id}/drain", h.setServerStatus(model.ServerDraining))
+	h.mux.HandleFunc("GET /admin/servers/{id}/drain", h.getDrainProgress)
+	h.mux.Handle("GET /debug/vars", expvar.Handler())
+
+	return h
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *AdminHandler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || h.token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+type serverHealthResponse struct {
+	ID                   string            `json:"id"`
+	Addr                 string            `json:"addr"`
+	State                model.HealthState `json:"state"`
+	Since                time.Time         `json:"since"`
+	LastCheck            *time.Time        `json:"last_check,omitempty"`
+	LatencyMS            float64           `json:"latency_ms"`
+	LastError            string            `json:"last_error,omitempty"`
+	ConsecutiveFailures  int               `json:"consecutive_failures"`
+	ConsecutiveSuccesses int               `json:"consecutive_successes"`
+}
+
+func (h *AdminHandler) getHealth(w http.ResponseWriter, _ *http.Request) {
+	health := h.health.Health()
+
+	res := make([]serverHealthResponse, 0, len(health))
+	for _, s := range health {
+		item := serverHealthResponse{
+			ID:                   s.Server.ID.String(),
+			Addr:                 s.Server.Addr,
+			State:                s.State,
+			Since:                s.Since,
+			LatencyMS:            float64(s.Latency) / float64(time.Millisecond),
+			LastError:            s.LastError,
+			ConsecutiveFailures:  s.ConsecutiveFailures,
+			ConsecutiveSuccesses: s.ConsecutiveSuccesses,
+		}
+		if !s.LastCheck.IsZero() {
+			item.LastCheck = &s.LastCheck
+		}
+		res = append(res, item)
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+type clusterResponse struct {
+	Servers     int   `json:"servers"`
+	Objects     int64 `json:"objects"`
+	ObjectBytes int64 `json:"object_bytes"`
+	UsedSpace   int64 `json:"used_space"`
+	Capacity    int64 `json:"capacity"`
+	Imbalance   struct {
+		UsedSpaceCV       float64 `json:"used_space_cv"`
+		UtilizationSpread float64 `json:"utilization_spread"`
+	} `json:"imbalance"`
+}
+
+func (h *AdminHandler) getCluster(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.cluster.Stats(r.Context())
+	if err != nil {
+		respondWithInternalError(w, "Failed to get cluster stats", err)
+		return
+	}
+
+	res := clusterResponse{
+		Servers:     stats.Servers,
+		Objects:     stats.Objects,
+		ObjectBytes: stats.ObjectBytes,
+		UsedSpace:   stats.UsedSpace,
+		Capacity:    stats.Capacity,
+	}
+	res.Imbalance.UsedSpaceCV = stats.UsedSpaceCV
+	res.Imbalance.UtilizationSpread = stats.UtilizationSpread
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+type placementViolationResponse struct {
+	Object  string             `json:"object"`
+	Layout  model.LayoutScheme `json:"layout"`
+	Reasons []string           `json:"reasons"`
+}
+
+type placementViolationsResponse struct {
+	Violations []placementViolationResponse `json:"violations"`
+	// NextCursor is passed as cursor to get the next page, empty on the last one.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// listPlacementViolations returns a page of at most limit violations, the first one by default,
+// or the one after the given cursor.
+func (h *AdminHandler) listPlacementViolations(w http.ResponseWriter, r *http.Request) {
+	limit := defaultViolationsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxViolationsLimit {
+			http.Error(w, fmt.Sprintf("Invalid limit, expected 1 to %d", maxViolationsLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	violations, next, err := h.cluster.PlacementViolations(r.Context(), r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		respondWithInternalError(w, "Failed to check placement", err)
+		return
+	}
+
+	res := placementViolationsResponse{
+		Violations: make([]placementViolationResponse, 0, len(violations)),
+		NextCursor: next,
+	}
+	for _, v := range violations {
+		res.Violations = append(res.Violations, placementViolationResponse{
+			Object:  v.ObjectName,
+			Layout:  v.Layout,
+			Reasons: v.Reasons,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+type moveResponse struct {
+	ID             string           `json:"id"`
+	Object         string           `json:"object"`
+	SeqNum         int              `json:"seq_num"`
+	FragmentID     string           `json:"fragment_id"`
+	FragmentSize   int64            `json:"fragment_size"`
+	SourceServerID string           `json:"source_server_id"`
+	TargetServerID string           `json:"target_server_id"`
+	Reason         model.MoveReason `json:"reason"`
+	State          model.MoveState  `json:"state"`
+	Attempts       int              `json:"attempts"`
+	LastError      string           `json:"last_error,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+func (h *AdminHandler) listMoves(w http.ResponseWriter, r *http.Request) {
+	moves, err := h.cluster.Moves(r.Context())
+	if err != nil {
+		respondWithInternalError(w, "Failed to list fragment moves", err)
+		return
+	}
+
+	res := make([]moveResponse, 0, len(moves))
+	for _, m := range moves {
+		res = append(res, moveResponse{
+			ID:             m.ID.String(),
+			Object:         m.ObjectName,
+			SeqNum:         m.SeqNum,
+			FragmentID:     m.FragmentID.String(),
+			FragmentSize:   m.FragmentSize,
+			SourceServerID: m.SourceServerID.String(),
+			TargetServerID: m.TargetServerID.String(),
+			Reason:         m.Reason,
+			State:          m.State,
+			Attempts:       m.Attempts,
+			LastError:      m.LastError,
+			CreatedAt:      m.CreatedAt,
+			UpdatedAt:      m.UpdatedAt,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+type repairResponse struct {
+	Object    string            `json:"object"`
+	Missing   int               `json:"missing"`
+	Repaired  int               `json:"repaired"`
+	State     model.RepairState `json:"state"`
+	Attempts  int               `json:"attempts"`
+	LastError string            `json:"last_error,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+func (h *AdminHandler) listRepairs(w http.ResponseWriter, r *http.Request) {
+	repairs, err := h.cluster.Repairs(r.Context())
+	if err != nil {
+		respondWithInternalError(w, "Failed to list repairs", err)
+		return
+	}
+
+	res := make([]repairResponse, 0, len(repairs))
+	for _, rp := range repairs {
+		res = append(res, repairResponse{
+			Object:    rp.ObjectName,
+			Missing:   rp.Missing,
+			Repaired:  rp.Repaired,
+			State:     rp.State,
+			Attempts:  rp.Attempts,
+			LastError: rp.LastError,
+			CreatedAt: rp.CreatedAt,
+			UpdatedAt: rp.UpdatedAt,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+type gcReportResponse struct {
+	DryRun     bool               `json:"dry_run"`
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt time.Time          `json:"finished_at"`
+	Servers    []gcServerResponse `json:"servers"`
+}
+
+type gcServerResponse struct {
+	ID          string           `json:"id"`
+	Addr        string           `json:"addr"`
+	Fragments   int64            `json:"fragments"`
+	OrphanCount int64            `json:"orphan_count"`
+	OrphanBytes int64            `json:"orphan_bytes"`
+	Deleted     int64            `json:"deleted"`
+	Orphans     []orphanResponse `json:"orphans"`
+	Error       string           `json:"error,omitempty"`
+}
+
+type orphanResponse struct {
+	FragmentID string    `json:"fragment_id"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+}
+
+func newGCReportResponse(report model.GCReport) gcReportResponse {
+	res := gcReportResponse{
+		DryRun:     report.DryRun,
+		StartedAt:  report.StartedAt,
+		FinishedAt: report.FinishedAt,
+		Servers:    make([]gcServerResponse, 0, len(report.Servers)),
+	}
+
+	for _, s := range report.Servers {
+		item := gcServerResponse{
+			ID:          s.Server.ID.String(),
+			Addr:        s.Server.Addr,
+			Fragments:   s.Fragments,
+			OrphanCount: s.OrphanCount,
+			OrphanBytes: s.OrphanBytes,
+			Deleted:     s.Deleted,
+			Orphans:     make([]orphanResponse, 0, len(s.Orphans)),
+			Error:       s.Error,
+		}
+		for _, o := range s.Orphans {
+			item.Orphans = append(item.Orphans, orphanResponse{
+				FragmentID: o.FragmentID.String(),
+				Size:       o.Size,
+				ModTime:    o.ModTime,
+			})
+		}
+		res.Servers = append(res.Servers, item)
+	}
+
+	return res
+}
+
+func (h *AdminHandler) getGCReport(w http.ResponseWriter, _ *http.Request) {
+	report, ok := h.gc.LastReport()
+	if !ok {
+		http.Error(w, "No garbage collection has run yet", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newGCReportResponse(report))
+}
+
+// collectGarbage runs a garbage collection pass and returns its report.
+// It only reports orphaned fragments unless dry_run=false is passed.
+func (h *AdminHandler) collectGarbage(w http.ResponseWriter, r *http.Request) {
+	dryRun := true
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "Invalid dry_run", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := h.gc.Collect(r.Context(), dryRun)
+	if err != nil {
+		if errors.Is(err, model.ErrGCRunning) {
+			http.Error(w, model.ErrGCRunning.Error(), http.StatusConflict)
+			return
+		}
+		respondWithInternalError(w, "Failed to collect garbage", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newGCReportResponse(report))
+}
+
+type serverResponse struct {
+	ID              string             `json:"id"`
+	Addr            string             `json:"addr"`
+	Status          model.ServerStatus `json:"status"`
+	Health          model.HealthState  `json:"health"`
+	UsedSpace       int64              `json:"used_space"`
+	Capacity        int64              `json:"capacity"`
+	FragmentCount   int64              `json:"fragment_count"`
+	Labels          map[string]string  `json:"labels,omitempty"`
+	LastHeartbeatAt *time.Time         `json:"last_heartbeat_at,omitempty"`
+	Stale           bool               `json:"stale"`
+	Static          bool               `json:"static"`
+}
+
+func newServerResponse(s model.ServerOverview) serverResponse {
+	res := serverResponse{
+		ID:            s.Server.ID.String(),
+		Addr:          s.Server.Addr,
+		Status:        s.Server.Status,
+		Health:        s.Health,
+		UsedSpace:     s.Server.UsedSpace,
+		Capacity:      s.Server.Capacity,
+		FragmentCount: s.FragmentCount,
+		Labels:        s.Server.Labels,
+		Stale:         s.Server.Stale,
+		Static:        s.Server.Static,
+	}
+	if !s.Server.LastHeartbeatAt.IsZero() {
+		res.LastHeartbeatAt = &s.Server.LastHeartbeatAt
+	}
+
+	return res
+}
+
+func (h *AdminHandler) listServers(w http.ResponseWriter, r *http.Request) {
+	servers, err := h.cluster.ListServers(r.Context())
+	if err != nil {
+		respondWithInternalError(w, "Failed to list servers", err)
+		return
+	}
+
+	res := make([]serverResponse, 0, len(servers))
+	for _, s := range servers {
+		res = append(res, newServerResponse(s))
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+type addServerRequest struct {
+	Addr     string            `json:"addr"`
+	Capacity int64             `json:"capacity"`
+	Labels   map[string]string `json:"labels"`
+}
+
+func (h *AdminHandler) addServer(w http.ResponseWriter, r *http.Request) {
+	var req addServerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server, err := h.cluster.AddServer(r.Context(), model.Server{
+		Addr:     req.Addr,
+		Capacity: req.Capacity,
+		Labels:   req.Labels,
+	})
+	if err != nil {
+		if errors.Is(err, model.ErrServerAddrEmpty) {
+			http.Error(w, model.ErrServerAddrEmpty.Error(), http.StatusBadRequest)
+			return
+		}
+		respondWithInternalError(w, "Failed to add server", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newServerResponse(model.ServerOverview{
+		Server: server,
+		Health: model.HealthUnknown,
+	}))
+}
+
+func (h *AdminHandler) removeServer(w http.ResponseWriter, r *http.Request) {
+	serverID, ok := parseServerID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.cluster.RemoveServer(r.Context(), serverID); err != nil {
+		respondWithServerError(w, "Failed to remove server", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) setServerStatus(status model.ServerStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serverID, ok := parseServerID(w, r)
+		if !ok {
+			return
+		}
+
+		if err := h.cluster.SetServerStatus(r.Context(), serverID, status); err != nil {
+			respondWithServerError(w, "Failed to change server status", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type drainProgressResponse struct {
+	ID                 string             `json:"id"`
+	Addr               string             `json:"addr"`
+	Status             model.ServerStatus `json:"status"`
+	RemainingFragments int64              `json:"remaining_fragments"`
+	RemainingBytes     int64              `json:"remaining_bytes"`
+	Moves              struct {
+		Pending  int `json:"pending"`
+		Switched int `json:"switched"`
+		Failed   int `json:"failed"`
+	} `json:"moves"`
+	Done bool `json:"done"`
+}
+
+func (h *AdminHandler) getDrainProgress(w http.ResponseWriter, r *http.Request) {
+	serverID, ok := parseServerID(w, r)
+	if !ok {
+		return
+	}
+
+	progress, err := h.cluster.DrainProgress(r.Context(), serverID)
+	if err != nil {
+		respondWithServerError(w, "Failed to get drain progress", err)
+		return
+	}
+
+	res := drainProgressResponse{
+		ID:                 progress.Server.ID.String(),
+		Addr:               progress.Server.Addr,
+		Status:             progress.Server.Status,
+		RemainingFragments: progress.Remaining.Count,
+		RemainingBytes:     progress.Remaining.Bytes,
+		Done:               progress.Done(),
+	}
+	res.Moves.Pending = progress.PendingMoves
+	res.Moves.Switched = progress.SwitchedMoves
+	res.Moves.Failed = progress.FailedMoves
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func parseServerID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	serverID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid server ID", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	return serverID, true
+}
+
+func respondWithServerError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, model.ErrServerNotFound):
+		http.Error(w, model.ErrServerNotFound.Error(), http.StatusNotFound)
+	case errors.Is(err, model.ErrServerNotEmpty):
+		http.Error(w, model.ErrServerNotEmpty.Error(), http.StatusConflict)
+	default:
+		respondWithInternalError(w, message, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write response", "err", err)
+	}
+}
@@ -2,10 +2,15 @@ package http
 
 import (
 	"context"
+	"crypto/md5" //nolint:gosec // Only the digest size is used.
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,9 +18,18 @@ import (
 	"github.com/ssimpl/simple-storage/internal/api/model"
 )
 
+const (
+	contentTypeOctetStream = "application/octet-stream"
+	headerContentSHA256    = "X-Content-Sha256"
+)
+
 type objectManager interface {
-	StoreObject(ctx context.Context, objectName string, src io.Reader, size int64) error
-	RetrieveObject(ctx context.Context, objectName string, dst io.Writer) error
+	StoreObject(
+		ctx context.Context, objectName string, src io.Reader, size int64, expected model.ContentDigests,
+	) (model.ObjectMeta, error)
+	GetObjectMeta(ctx context.Context, objectName string) (model.ObjectMeta, error)
+	RetrieveObject(ctx context.Context, meta model.ObjectMeta, offset, length int64, dst io.Writer) error
+	DeleteObject(ctx context.Context, objectName string) error
 }
 
 type Handler struct {
@@ -33,6 +47,8 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.uploadFile(w, r)
 	case http.MethodGet:
 		h.downloadFile(w, r)
+	case http.MethodDelete:
+		h.deleteFile(w, r)
 	default:
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 	}
@@ -51,6 +67,12 @@ func (h *Handler) uploadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	expected, err := parseContentDigests(r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	slog.Info("Received file", "name", fileName, "size", size)
 
 	fileData := http.MaxBytesReader(w, r.Body, h.fileSizeLimit)
@@ -60,16 +82,26 @@ func (h *Handler) uploadFile(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	if err := h.objManager.StoreObject(r.Context(), fileName, fileData, size); err != nil {
+	meta, err := h.objManager.StoreObject(r.Context(), fileName, fileData, size, expected)
+	if err != nil {
 		var errMaxBytes *http.MaxBytesError
 		if errors.As(err, &errMaxBytes) {
 			http.Error(w, "File size exceeds the limit", http.StatusRequestEntityTooLarge)
 			return
 		}
+		if errors.Is(err, model.ErrChecksumMismatch) {
+			http.Error(w, "Content digest does not match the uploaded data", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, model.ErrSizeMismatch) {
+			http.Error(w, "Content-Length does not match the uploaded data", http.StatusBadRequest)
+			return
+		}
 		respondWithInternalError(w, "Failed to store object", err)
 		return
 	}
 
+	w.Header().Set("ETag", etag(meta))
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -80,10 +112,8 @@ func (h *Handler) downloadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
-	w.Header().Set("Content-Type", "application/octet-stream")
-
-	if err := h.objManager.RetrieveObject(r.Context(), fileName, w); err != nil {
+	meta, err := h.objManager.GetObjectMeta(r.Context(), fileName)
+	if err != nil {
 		if errors.Is(err, model.ErrObjectNotFound) {
 			http.Error(w, model.ErrObjectNotFound.Error(), http.StatusBadRequest)
 			return
@@ -92,9 +122,154 @@ func (h *Handler) downloadFile(w http.ResponseWriter, r *http.Request) {
 		respondWithInternalError(w, "Failed to retrieve object", err)
 		return
 	}
+
+	if meta.Checksum != "" {
+		w.Header().Set("ETag", etag(meta))
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+
+	// Ranges of an object of unknown size can't be resolved, so it is served in full.
+	if meta.SizeUnknown {
+		h.serveObject(w, r, meta)
+		return
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" {
+		h.serveObject(w, r, meta)
+		return
+	}
+
+	ranges, err := parseRange(rangeHeader, meta.Size)
+	if errors.Is(err, errInvalidRange) {
+		// A malformed Range header is ignored, as RFC 9110 requires.
+		h.serveObject(w, r, meta)
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", meta.Size))
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	switch {
+	case sumRangesSize(ranges) > meta.Size:
+		// The client asked for more than the whole object, most likely with overlapping ranges.
+		h.serveObject(w, r, meta)
+	case len(ranges) == 1:
+		h.serveRange(w, r, meta, ranges[0])
+	default:
+		h.serveMultipartRanges(w, r, meta, ranges)
+	}
+}
+
+func (h *Handler) serveObject(w http.ResponseWriter, r *http.Request, meta model.ObjectMeta) {
+	w.Header().Set("Content-Type", contentTypeOctetStream)
+	if !meta.SizeUnknown {
+		w.Header().Set("Content-Length", strconv.FormatInt(meta.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	if err := h.objManager.RetrieveObject(r.Context(), meta, 0, meta.Size, w); err != nil {
+		abortResponse("Failed to retrieve object", err)
+	}
+}
+
+func (h *Handler) serveRange(w http.ResponseWriter, r *http.Request, meta model.ObjectMeta, ra httpRange) {
+	w.Header().Set("Content-Type", contentTypeOctetStream)
+	w.Header().Set("Content-Range", ra.contentRange(meta.Size))
+	w.Header().Set("Content-Length", strconv.FormatInt(ra.length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+
+	if err := h.objManager.RetrieveObject(r.Context(), meta, ra.start, ra.length, w); err != nil {
+		abortResponse("Failed to retrieve object range", err)
+	}
+}
+
+func (h *Handler) serveMultipartRanges(
+	w http.ResponseWriter, r *http.Request, meta model.ObjectMeta, ranges []httpRange,
+) {
+	mw := multipart.NewWriter(w)
+
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.Header().Set("Content-Length", strconv.FormatInt(
+		multipartSize(ranges, mw.Boundary(), contentTypeOctetStream, meta.Size), 10,
+	))
+	w.WriteHeader(http.StatusPartialContent)
+
+	for _, ra := range ranges {
+		part, err := mw.CreatePart(ra.mimeHeader(contentTypeOctetStream, meta.Size))
+		if err != nil {
+			abortResponse("Failed to write multipart header", err)
+		}
+
+		if err := h.objManager.RetrieveObject(r.Context(), meta, ra.start, ra.length, part); err != nil {
+			abortResponse("Failed to retrieve object range", err)
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		abortResponse("Failed to finish multipart response", err)
+	}
+}
+
+func (h *Handler) deleteFile(w http.ResponseWriter, r *http.Request) {
+	fileName := strings.Trim(r.URL.Path, "/")
+	if fileName == "" {
+		http.Error(w, "File name is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.objManager.DeleteObject(r.Context(), fileName); err != nil {
+		if errors.Is(err, model.ErrObjectNotFound) {
+			http.Error(w, model.ErrObjectNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		respondWithInternalError(w, "Failed to delete object", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseContentDigests reads the digests the client declared for the uploaded content:
+// base64 MD5 in Content-MD5 (RFC 1864) and hex SHA-256 in X-Content-Sha256.
+func parseContentDigests(header http.Header) (model.ContentDigests, error) {
+	var digests model.ContentDigests
+
+	if v := header.Get("Content-MD5"); v != "" {
+		sum, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(sum) != md5.Size {
+			return model.ContentDigests{}, fmt.Errorf("invalid Content-MD5 header")
+		}
+		digests.MD5 = sum
+	}
+
+	if v := header.Get(headerContentSHA256); v != "" {
+		sum, err := hex.DecodeString(v)
+		if err != nil || len(sum) != sha256.Size {
+			return model.ContentDigests{}, fmt.Errorf("invalid %s header", headerContentSHA256)
+		}
+		digests.SHA256 = sum
+	}
+
+	return digests, nil
+}
+
+func etag(meta model.ObjectMeta) string {
+	return `"` + meta.Checksum + `"`
 }
 
 func respondWithInternalError(w http.ResponseWriter, message string, err error) {
 	slog.Error(message, "err", err)
 	http.Error(w, message, http.StatusInternalServerError)
 }
+
+// abortResponse is used once the response headers are sent: it breaks the connection
+// so the client notices the body is incomplete instead of getting a trailing error message.
+func abortResponse(message string, err error) {
+	slog.Error(message, "err", err)
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,132 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const rangeUnitPrefix = "bytes="
+
+var (
+	errInvalidRange       = errors.New("invalid range")
+	errUnsatisfiableRange = errors.New("unsatisfiable range")
+)
+
+// httpRange is a byte range resolved against the object size.
+type httpRange struct {
+	start  int64
+	length int64
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+func (r httpRange) mimeHeader(contentType string, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Range": {r.contentRange(size)},
+		"Content-Type":  {contentType},
+	}
+}
+
+// parseRange parses a Range header value as described in RFC 9110, section 14.1.2.
+// A malformed header fails with errInvalidRange. Ranges not overlapping the object are skipped,
+// if none overlaps, errUnsatisfiableRange is returned.
+func parseRange(header string, size int64) ([]httpRange, error) {
+	if !strings.HasPrefix(header, rangeUnitPrefix) {
+		return nil, errInvalidRange
+	}
+
+	var ranges []httpRange
+	var specs int
+	for _, spec := range strings.Split(header[len(rangeUnitPrefix):], ",") {
+		spec = textproto.TrimString(spec)
+		if spec == "" {
+			continue
+		}
+		specs++
+
+		startStr, endStr, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, errInvalidRange
+		}
+		startStr, endStr = textproto.TrimString(startStr), textproto.TrimString(endStr)
+
+		var r httpRange
+		if startStr == "" {
+			// Suffix range: the last N bytes of the object.
+			suffix, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, errInvalidRange
+			}
+			if suffix == 0 || size == 0 {
+				continue
+			}
+			suffix = min(suffix, size)
+			r = httpRange{start: size - suffix, length: suffix}
+		} else {
+			start, err := strconv.ParseInt(startStr, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errInvalidRange
+			}
+
+			end := size - 1
+			if endStr != "" {
+				end, err = strconv.ParseInt(endStr, 10, 64)
+				if err != nil || end < start {
+					return nil, errInvalidRange
+				}
+			}
+			if start >= size {
+				continue
+			}
+			r = httpRange{start: start, length: min(end, size-1) - start + 1}
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	if specs == 0 {
+		return nil, errInvalidRange
+	}
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+
+	return ranges, nil
+}
+
+// multipartSize returns the size of a multipart/byteranges body for the given ranges.
+func multipartSize(ranges []httpRange, boundary, contentType string, size int64) int64 {
+	var counter countingWriter
+	mw := multipart.NewWriter(&counter)
+	_ = mw.SetBoundary(boundary)
+
+	var dataSize int64
+	for _, r := range ranges {
+		_, _ = mw.CreatePart(r.mimeHeader(contentType, size))
+		dataSize += r.length
+	}
+	_ = mw.Close()
+
+	return int64(counter) + dataSize
+}
+
+func sumRangesSize(ranges []httpRange) int64 {
+	var sum int64
+	for _, r := range ranges {
+		sum += r.length
+	}
+	return sum
+}
+
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,229 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"slices"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		size    int64
+		want    []httpRange
+		wantErr error
+	}{
+		{
+			name:   "first and last byte",
+			header: "bytes=0-99",
+			size:   1000,
+			want:   []httpRange{{start: 0, length: 100}},
+		},
+		{
+			name:   "open end",
+			header: "bytes=500-",
+			size:   1000,
+			want:   []httpRange{{start: 500, length: 500}},
+		},
+		{
+			name:   "end past the object",
+			header: "bytes=900-2000",
+			size:   1000,
+			want:   []httpRange{{start: 900, length: 100}},
+		},
+		{
+			name:   "suffix",
+			header: "bytes=-100",
+			size:   1000,
+			want:   []httpRange{{start: 900, length: 100}},
+		},
+		{
+			name:   "suffix longer than the object",
+			header: "bytes=-2000",
+			size:   1000,
+			want:   []httpRange{{start: 0, length: 1000}},
+		},
+		{
+			name:   "several ranges",
+			header: "bytes=0-0, -1",
+			size:   1000,
+			want:   []httpRange{{start: 0, length: 1}, {start: 999, length: 1}},
+		},
+		{
+			name:   "overlapping ranges",
+			header: "bytes=0-499,250-749",
+			size:   1000,
+			want:   []httpRange{{start: 0, length: 500}, {start: 250, length: 500}},
+		},
+		{
+			name:   "whitespace and empty elements",
+			header: "bytes= 0 - 1 ,, 10-19 ",
+			size:   1000,
+			want:   []httpRange{{start: 0, length: 2}, {start: 10, length: 10}},
+		},
+		{
+			name:   "ranges past the object skipped",
+			header: "bytes=2000-3000,0-9",
+			size:   1000,
+			want:   []httpRange{{start: 0, length: 10}},
+		},
+		{
+			name:    "start at the end",
+			header:  "bytes=1000-",
+			size:    1000,
+			wantErr: errUnsatisfiableRange,
+		},
+		{
+			name:    "all ranges past the object",
+			header:  "bytes=1000-1100, 2000-",
+			size:    1000,
+			wantErr: errUnsatisfiableRange,
+		},
+		{
+			name:    "empty suffix",
+			header:  "bytes=-0",
+			size:    1000,
+			wantErr: errUnsatisfiableRange,
+		},
+		{
+			name:    "suffix of an empty object",
+			header:  "bytes=-10",
+			size:    0,
+			wantErr: errUnsatisfiableRange,
+		},
+		{
+			name:    "empty object",
+			header:  "bytes=0-",
+			size:    0,
+			wantErr: errUnsatisfiableRange,
+		},
+		{
+			name:    "other unit",
+			header:  "items=0-1",
+			size:    1000,
+			wantErr: errInvalidRange,
+		},
+		{
+			name:    "no ranges",
+			header:  "bytes=",
+			size:    1000,
+			wantErr: errInvalidRange,
+		},
+		{
+			name:    "only separators",
+			header:  "bytes= , ,",
+			size:    1000,
+			wantErr: errInvalidRange,
+		},
+		{
+			name:    "no dash",
+			header:  "bytes=100",
+			size:    1000,
+			wantErr: errInvalidRange,
+		},
+		{
+			name:    "not a number",
+			header:  "bytes=a-1",
+			size:    1000,
+			wantErr: errInvalidRange,
+		},
+		{
+			name:    "end before start",
+			header:  "bytes=5-2",
+			size:    1000,
+			wantErr: errInvalidRange,
+		},
+		{
+			name:    "negative suffix",
+			header:  "bytes=--1",
+			size:    1000,
+			wantErr: errInvalidRange,
+		},
+		{
+			name:    "one malformed range",
+			header:  "bytes=0-1,x",
+			size:    1000,
+			wantErr: errInvalidRange,
+		},
+		{
+			name:    "malformed range past the object",
+			header:  "bytes=2000-1",
+			size:    1000,
+			wantErr: errInvalidRange,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRange(tt.header, tt.size)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseRange(%q, %d) error = %v, want %v", tt.header, tt.size, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseRange(%q, %d) = %v, want %v", tt.header, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultipartSize(t *testing.T) {
+	const (
+		boundary    = "3d6b6a416f9b5"
+		contentType = "application/octet-stream"
+		size        = 12345
+	)
+
+	tests := []struct {
+		name   string
+		ranges []httpRange
+	}{
+		{
+			name:   "one range",
+			ranges: []httpRange{{start: 0, length: 100}},
+		},
+		{
+			name:   "several ranges",
+			ranges: []httpRange{{start: 0, length: 1}, {start: 500, length: 1000}, {start: 12344, length: 1}},
+		},
+		{
+			name:   "overlapping ranges",
+			ranges: []httpRange{{start: 0, length: 500}, {start: 250, length: 500}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			if err := mw.SetBoundary(boundary); err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range tt.ranges {
+				part, err := mw.CreatePart(r.mimeHeader(contentType, size))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := part.Write(make([]byte, r.length)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := mw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := multipartSize(tt.ranges, boundary, contentType, size); got != int64(body.Len()) {
+				t.Errorf("multipartSize() = %d, want %d", got, body.Len())
+			}
+		})
+	}
+}
+
+func TestSumRangesSize(t *testing.T) {
+	ranges := []httpRange{{start: 0, length: 500}, {start: 250, length: 500}, {start: 999, length: 1}}
+	if got := sumRangesSize(ranges); got != 1001 {
+		t.Errorf("sumRangesSize() = %d, want 1001", got)
+	}
+}
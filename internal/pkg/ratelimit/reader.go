@@ -0,0 +1,52 @@
+// Package ratelimit paces background data transfers, so they leave bandwidth and disk time to client requests.
+package ratelimit
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// minBurst is the smallest burst of a limiter, so reads are not cut into tiny pieces at low rates.
+const minBurst = 64 << 10
+
+// NewLimiter returns a limiter allowing bytesPerSecond bytes per second, without a limit if it is 0.
+func NewLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(max(bytesPerSecond, minBurst)))
+}
+
+// Reader reads from r no faster than the limiter allows.
+type Reader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+// NewReader returns a reader waiting for the limiter after every read; waiting ends with the context.
+func NewReader(ctx context.Context, r io.Reader, limiter *rate.Limiter) *Reader {
+	return &Reader{
+		ctx:     ctx,
+		r:       r,
+		limiter: limiter,
+	}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if burst := r.limiter.Burst(); r.limiter.Limit() != rate.Inf && len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ssimpl/simple-storage/internal/storage/model"
+	"github.com/ssimpl/simple-storage/pkg/registry"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Client talks to the server registry of the API server, authenticating with the shared registry token.
+type Client struct {
+	conn    *grpc.ClientConn
+	token   string
+	timeout time.Duration
+}
+
+func NewClient(addr, token string, timeout time.Duration) (*Client, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create grpc client: %w", err)
+	}
+
+	return &Client{
+		conn:    conn,
+		token:   token,
+		timeout: timeout,
+	}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Register returns the server ID assigned by the registry and the period heartbeats are expected at.
+func (c *Client) Register(ctx context.Context, reg model.Registration) (string, time.Duration, error) {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+
+	res, err := registry.NewRegistryClient(c.conn).Register(ctx, &registry.RegisterRequest{
+		Addr:     reg.Addr,
+		Capacity: reg.Capacity,
+		Labels:   reg.Labels,
+		ServerId: reg.ServerID,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to register: %w", err)
+	}
+
+	return res.GetServerId(), res.GetHeartbeatInterval().AsDuration(), nil
+}
+
+// Heartbeat reports the server alive, along with the IDs of corrupt fragments found since the previous one.
+// It fails with model.ErrNotRegistered if the registry doesn't know the server.
+func (c *Client) Heartbeat(ctx context.Context, serverID string, capacity int64, corrupt []string) error {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+
+	_, err := registry.NewRegistryClient(c.conn).Heartbeat(ctx, &registry.HeartbeatRequest{
+		ServerId:           serverID,
+		Capacity:           capacity,
+		CorruptFragmentIds: corrupt,
+	})
+	if status.Code(err) == codes.NotFound {
+		return fmt.Errorf("failed to send heartbeat: %w", model.ErrNotRegistered)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send heartbeat: %w", err)
+	}
+
+	return nil
+}
+
+// callContext bounds a call by the client timeout and attaches the registry token to it.
+func (c *Client) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+	return context.WithTimeout(ctx, c.timeout)
+}
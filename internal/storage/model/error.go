@@ -8,5 +8,11 @@ func (e Error) Error() string {
 
 const (
 	ErrObjectNameRequired Error = "object name is required"
+	ErrInvalidObjectName  Error = "invalid object name"
 	ErrObjectNotFound     Error = "object not found"
+	ErrInvalidRange       Error = "invalid range"
+	ErrSizeMismatch       Error = "size mismatch"
+	ErrChecksumMismatch   Error = "checksum mismatch"
+	ErrUploadNotCommitted Error = "upload not committed"
+	ErrNotRegistered      Error = "server not registered"
 )
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+type ObjectInfo struct {
+	Exists   bool
+	Size     int64
+	ModTime  time.Time
+	Checksum string
+}
+
+// ObjectCommit is what the uploader declares about the data it sent.
+type ObjectCommit struct {
+	Size     int64
+	Checksum string
+}
+
+// ObjectEntry is an object found when listing the storage.
+type ObjectEntry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
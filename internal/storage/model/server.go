@@ -0,0 +1,17 @@
+package model
+
+// Labels locating the server, used by the API server to spread fragments across failure domains.
+const (
+	LabelZone = "zone"
+	LabelRack = "rack"
+)
+
+// Registration describes the server to the cluster.
+type Registration struct {
+	// ServerID is the ID the server registered with before, empty on its first registration.
+	ServerID string
+	// Addr is the address the API server reaches this server at.
+	Addr     string
+	Capacity int64
+	Labels   map[string]string
+}
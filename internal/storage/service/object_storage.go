@@ -4,14 +4,33 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/ssimpl/simple-storage/internal/storage/model"
 )
 
+// tempFilePrefix marks fragments that are still being written.
+// Such files are never served and are removed on startup.
+const tempFilePrefix = ".tmp-"
+
+// checksumFileSuffix is appended to the object file name to get the file
+// holding the hex-encoded SHA-256 of the object content.
+const checksumFileSuffix = ".sha256"
+
+// quarantineDirName is the directory under the storage path corrupt objects are moved to.
+const quarantineDirName = ".quarantine"
+
+// serverIDFileName is the file under the storage path holding the ID the server is registered in the cluster with.
+const serverIDFileName = ".server-id"
+
 type ObjectStorage struct {
 	storagePath string
 }
@@ -22,28 +41,112 @@ func NewObjectStorage(storagePath string) *ObjectStorage {
 	}
 }
 
-func (s *ObjectStorage) StoreObject(_ context.Context, objectName string, src io.Reader) error {
+// StoreObject writes the object into a temporary file and atomically renames it into place
+// once all data is flushed to disk, so readers see either the previous version or the new one.
+// When src is drained, commit is called to get the expected size and checksum:
+// the object is persisted only if both match the received data.
+func (s *ObjectStorage) StoreObject(
+	ctx context.Context, objectName string, src io.Reader, commit func() model.ObjectCommit,
+) error {
 	filePath := s.getFilePath(objectName)
+	dir := filepath.Dir(filePath)
 
-	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 		return fmt.Errorf("failed to create directories for %s: %w", filePath, err)
 	}
 
-	file, err := os.Create(filePath)
+	file, err := os.CreateTemp(dir, tempFilePrefix+objectName+"-*")
 	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", filePath, err)
+		return fmt.Errorf("failed to create temp file for %s: %w", filePath, err)
 	}
-	defer file.Close()
 
-	_, err = io.Copy(file, src)
+	tempPath := file.Name()
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		_ = file.Close()
+		if err := os.Remove(tempPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("failed to remove temp file", "path", tempPath, "err", err)
+		}
+	}()
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hash), src)
 	if err != nil {
-		return fmt.Errorf("failed to write data to file %s: %w", filePath, err)
+		return fmt.Errorf("failed to write data to file %s: %w", tempPath, err)
+	}
+
+	expected := commit()
+	if written != expected.Size {
+		return fmt.Errorf("expected %d bytes, received %d: %w", expected.Size, written, model.ErrSizeMismatch)
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if checksum != expected.Checksum {
+		return fmt.Errorf("expected %s, received %s: %w", expected.Checksum, checksum, model.ErrChecksumMismatch)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file %s: %w", tempPath, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close file %s: %w", tempPath, err)
+	}
+
+	// The checksum is written before the object is put in place, so failing to write it leaves the object as it was.
+	checksumPath := filePath + checksumFileSuffix
+	checksumTempPath, err := writeTempFile(checksumPath, []byte(checksum))
+	if err != nil {
+		return fmt.Errorf("failed to write checksum file %s: %w", checksumPath, err)
+	}
+	defer func() {
+		if err := os.Remove(checksumTempPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("failed to remove temp file", "path", checksumTempPath, "err", err)
+		}
+	}()
+
+	// An uploader giving up before getting the response doesn't consider the object stored, so it is discarded.
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("upload of %s canceled: %w", filePath, err)
+	}
+
+	// The checksum of the previous version is removed first: a crash before the new one
+	// is put in place leaves the object without a checksum rather than with a wrong one.
+	if err := os.Remove(checksumPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove checksum file %s: %w", checksumPath, err)
+	}
+
+	if err := os.Rename(tempPath, filePath); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", tempPath, filePath, err)
+	}
+	committed = true
+
+	if err := os.Rename(checksumTempPath, checksumPath); err != nil {
+		// The object is reported not stored, so it is removed rather than left in place unreferenced.
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("failed to remove object without checksum", "path", filePath, "err", err)
+		}
+		return fmt.Errorf("failed to rename %s to %s: %w", checksumTempPath, checksumPath, err)
+	}
+
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
 	}
 
 	return nil
 }
 
-func (s *ObjectStorage) RetrieveObject(_ context.Context, objectName string, dst io.Writer) error {
+// RetrieveObject writes length bytes of the object starting at offset to dst.
+// A zero length means reading up to the end of the object.
+func (s *ObjectStorage) RetrieveObject(
+	_ context.Context, objectName string, offset, length int64, dst io.Writer,
+) error {
+	if offset < 0 || length < 0 {
+		return fmt.Errorf("offset %d, length %d: %w", offset, length, model.ErrInvalidRange)
+	}
+
 	filePath := s.getFilePath(objectName)
 
 	file, err := os.Open(filePath)
@@ -55,7 +158,25 @@ func (s *ObjectStorage) RetrieveObject(_ context.Context, objectName string, dst
 	}
 	defer file.Close()
 
-	_, err = io.Copy(dst, file)
+	var src io.Reader = file
+	if offset > 0 || length > 0 {
+		stat, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat file %s: %w", filePath, err)
+		}
+		if offset > stat.Size() {
+			return fmt.Errorf("offset %d beyond size %d of %s: %w", offset, stat.Size(), filePath, model.ErrInvalidRange)
+		}
+
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek file %s: %w", filePath, err)
+		}
+		if length > 0 {
+			src = io.LimitReader(file, length)
+		}
+	}
+
+	_, err = io.Copy(dst, src)
 	if err != nil {
 		return fmt.Errorf("failed to read data from file %s: %w", filePath, err)
 	}
@@ -63,6 +184,162 @@ func (s *ObjectStorage) RetrieveObject(_ context.Context, objectName string, dst
 	return nil
 }
 
+// DeleteObject removes the object from disk. Deleting a missing object is not an error.
+func (s *ObjectStorage) DeleteObject(_ context.Context, objectName string) error {
+	filePath := s.getFilePath(objectName)
+
+	if err := os.Remove(filePath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove file %s: %w", filePath, err)
+	}
+
+	checksumPath := filePath + checksumFileSuffix
+	if err := os.Remove(checksumPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove checksum file %s: %w", checksumPath, err)
+	}
+
+	if err := syncDir(filepath.Dir(filePath)); err != nil {
+		return fmt.Errorf("failed to sync directory of %s: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// StatObject returns object metadata without reading its content.
+func (s *ObjectStorage) StatObject(_ context.Context, objectName string) (model.ObjectInfo, error) {
+	filePath := s.getFilePath(objectName)
+
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return model.ObjectInfo{}, nil
+		}
+		return model.ObjectInfo{}, fmt.Errorf("failed to stat file %s: %w", filePath, err)
+	}
+
+	checksumPath := filePath + checksumFileSuffix
+	checksum, err := os.ReadFile(checksumPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return model.ObjectInfo{}, fmt.Errorf("failed to read checksum file %s: %w", checksumPath, err)
+	}
+
+	return model.ObjectInfo{
+		Exists:   true,
+		Size:     stat.Size(),
+		ModTime:  stat.ModTime(),
+		Checksum: string(checksum),
+	}, nil
+}
+
+// ListObjects calls fn for every stored object, skipping temp files and quarantined objects.
+// Objects written or deleted while listing may or may not be seen.
+func (s *ObjectStorage) ListObjects(ctx context.Context, fn func(entry model.ObjectEntry) error) error {
+	err := filepath.WalkDir(s.storagePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == quarantineDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		objectName := d.Name()
+		if strings.HasPrefix(objectName, tempFilePrefix) || strings.HasSuffix(objectName, checksumFileSuffix) ||
+			path != s.getFilePath(objectName) {
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		return fn(model.ObjectEntry{
+			Name:    objectName,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk storage path %s: %w", s.storagePath, err)
+	}
+
+	return nil
+}
+
+// CleanupTempFiles removes leftovers of writes interrupted by a crash or restart.
+// It must be called before the storage starts accepting uploads.
+func (s *ObjectStorage) CleanupTempFiles(_ context.Context) error {
+	err := filepath.WalkDir(s.storagePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasPrefix(d.Name(), tempFilePrefix) {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove temp file %s: %w", path, err)
+		}
+		slog.Info("removed stale temp file", "path", path)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk storage path %s: %w", s.storagePath, err)
+	}
+
+	return nil
+}
+
+// ServerID returns the ID the server registered in the cluster with, empty if it never did.
+func (s *ObjectStorage) ServerID() (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.storagePath, serverIDFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read server id: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SaveServerID keeps the ID the server registered in the cluster with next to its fragments,
+// so the server keeps its identity across restarts and address changes.
+func (s *ObjectStorage) SaveServerID(id string) error {
+	if err := os.MkdirAll(s.storagePath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create storage path: %w", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(s.storagePath, serverIDFileName), []byte(id+"\n")); err != nil {
+		return fmt.Errorf("failed to write server id: %w", err)
+	}
+
+	if err := syncDir(s.storagePath); err != nil {
+		return fmt.Errorf("failed to sync storage path: %w", err)
+	}
+
+	return nil
+}
+
 func (s *ObjectStorage) getFilePath(objectName string) string {
 	hash := sha256.New()
 	hash.Write([]byte(objectName))
@@ -73,3 +350,68 @@ func (s *ObjectStorage) getFilePath(objectName string) string {
 
 	return filepath.Join(s.storagePath, subDir1, subDir2, objectName)
 }
+
+// writeFileAtomic writes a small file via a temp file and rename, so it is never seen half-written.
+func writeFileAtomic(path string, data []byte) error {
+	tempPath, err := writeTempFile(path, data)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+
+	return nil
+}
+
+// writeTempFile writes a small file next to path and flushes it to disk, returning its path.
+// It is to be renamed to path, or removed.
+func writeTempFile(path string, data []byte) (string, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), tempFilePrefix+filepath.Base(path)+"-*")
+	if err != nil {
+		return "", err
+	}
+	tempPath := file.Name()
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tempPath)
+		return "", err
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tempPath)
+		return "", err
+	}
+
+	if err := file.Close(); err != nil {
+		_ = os.Remove(tempPath)
+		return "", err
+	}
+
+	return tempPath, nil
+}
+
+// syncDir flushes directory entries, making a preceding rename durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// Capacity returns the size in bytes of the file system holding the storage path.
+func (s *ObjectStorage) Capacity() (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(s.storagePath, &stat); err != nil {
+		return 0, fmt.Errorf("failed to stat file system of %s: %w", s.storagePath, err)
+	}
+
+	return int64(stat.Blocks) * int64(stat.Bsize), nil //nolint:gosec // Sizes fit in int64.
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ssimpl/simple-storage/internal/storage/model"
+)
+
+const (
+	registerInitialBackoff   = time.Second
+	registerMaxBackoff       = 30 * time.Second
+	defaultHeartbeatInterval = 10 * time.Second
+)
+
+type registryClient interface {
+	Register(ctx context.Context, reg model.Registration) (string, time.Duration, error)
+	Heartbeat(ctx context.Context, serverID string, capacity int64, corrupt []string) error
+}
+
+// serverIDStore keeps the ID the server got from the registry across restarts.
+type serverIDStore interface {
+	SaveServerID(id string) error
+}
+
+// corruptionReports holds IDs of corrupt fragments to report to the cluster with heartbeats.
+type corruptionReports interface {
+	Corrupt() []string
+	Reported(ids []string)
+}
+
+// Registration keeps the server registered in the cluster: it registers on start
+// and sends heartbeats, registering again if the registry forgot the server.
+// The server registers with the ID it got before, so its address can change.
+type Registration struct {
+	client   registryClient
+	ids      serverIDStore
+	reg      model.Registration
+	capacity func() int64
+	reports  corruptionReports
+}
+
+// NewRegistration creates a registration of the server. If reg.Capacity is 0,
+// the capacity is obtained from the capacity function before every heartbeat.
+// Corrupt fragments found by reports are sent with heartbeats; reports may be nil.
+func NewRegistration(
+	client registryClient, ids serverIDStore, reg model.Registration, capacity func() int64,
+	reports corruptionReports,
+) *Registration {
+	return &Registration{
+		client:   client,
+		ids:      ids,
+		reg:      reg,
+		capacity: capacity,
+		reports:  reports,
+	}
+}
+
+// Run keeps the server registered until the context is canceled.
+func (r *Registration) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		serverID, interval, ok := r.register(ctx)
+		if !ok {
+			return
+		}
+
+		r.sendHeartbeats(ctx, serverID, interval)
+	}
+}
+
+// register retries until the registry accepts the server or the context is canceled.
+func (r *Registration) register(ctx context.Context) (string, time.Duration, bool) {
+	backoff := registerInitialBackoff
+	for {
+		reg := r.reg
+		reg.Capacity = r.currentCapacity()
+
+		serverID, interval, err := r.client.Register(ctx, reg)
+		if err == nil {
+			if interval <= 0 {
+				interval = defaultHeartbeatInterval
+			}
+			slog.Info("Registered in cluster", "server_id", serverID, "addr", reg.Addr, "heartbeat_interval", interval)
+			r.keepServerID(serverID)
+			return serverID, interval, true
+		}
+
+		slog.Warn("Failed to register in cluster", "addr", reg.Addr, "retry_in", backoff, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return "", 0, false
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, registerMaxBackoff)
+	}
+}
+
+// keepServerID persists the ID the registry assigned, so the server registers with it from then on.
+func (r *Registration) keepServerID(serverID string) {
+	if serverID == r.reg.ServerID {
+		return
+	}
+	if r.reg.ServerID != "" {
+		slog.Warn("Registry assigned a new server ID", "previous_id", r.reg.ServerID, "server_id", serverID)
+	}
+
+	if err := r.ids.SaveServerID(serverID); err != nil {
+		// The server still works under the new ID; it registers by address again after a restart.
+		slog.Error("Failed to save server ID", "server_id", serverID, "err", err)
+	}
+	r.reg.ServerID = serverID
+}
+
+// sendHeartbeats returns when the registry no longer knows the server or the context is canceled.
+func (r *Registration) sendHeartbeats(ctx context.Context, serverID string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var corrupt []string
+		if r.reports != nil {
+			corrupt = r.reports.Corrupt()
+		}
+
+		err := r.client.Heartbeat(ctx, serverID, r.currentCapacity(), corrupt)
+		if errors.Is(err, model.ErrNotRegistered) {
+			slog.Warn("Server unknown to cluster, registering again", "server_id", serverID)
+			return
+		}
+		if err != nil {
+			slog.Warn("Failed to send heartbeat", "server_id", serverID, "err", err)
+			continue
+		}
+		if len(corrupt) > 0 {
+			slog.Info("Corrupt fragments reported", "count", len(corrupt))
+			r.reports.Reported(corrupt)
+		}
+	}
+}
+
+func (r *Registration) currentCapacity() int64 {
+	if r.reg.Capacity > 0 || r.capacity == nil {
+		return r.reg.Capacity
+	}
+	return r.capacity()
+}
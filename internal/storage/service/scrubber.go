@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/ssimpl/simple-storage/internal/pkg/ratelimit"
+	"github.com/ssimpl/simple-storage/internal/storage/model"
+)
+
+const (
+	defaultScrubInterval = 24 * time.Hour
+
+	// reportedFileSuffix marks quarantined objects already reported to the cluster.
+	reportedFileSuffix = ".reported"
+)
+
+type ScrubConfig struct {
+	// Interval is the pause between the end of a pass over all fragments and the start of the next one.
+	Interval time.Duration
+	// Bandwidth is the maximum number of bytes per second read while scrubbing. Zero means no limit.
+	Bandwidth int64
+}
+
+// Scrubber reads every fragment in the background, comparing its content with its stored checksum.
+// Corrupt fragments are moved to the quarantine directory, so they are not served anymore,
+// and reported to the cluster, which rebuilds them from other replicas or shards. Quarantined fragments
+// are marked once reported, so those not reported before a restart are reported after it.
+type Scrubber struct {
+	storage *ObjectStorage
+	cfg     ScrubConfig
+	limiter *rate.Limiter
+
+	mu      sync.Mutex
+	corrupt []quarantinedObject
+}
+
+// quarantinedObject is an object moved to the quarantine directory.
+type quarantinedObject struct {
+	name string
+	path string
+}
+
+func NewScrubber(storage *ObjectStorage, cfg ScrubConfig) *Scrubber {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultScrubInterval
+	}
+
+	return &Scrubber{
+		storage: storage,
+		cfg:     cfg,
+		limiter: ratelimit.NewLimiter(cfg.Bandwidth),
+	}
+}
+
+// Run scrubs all fragments, starting right away and then Interval after every pass, until the context is canceled.
+func (s *Scrubber) Run(ctx context.Context) {
+	unreported, err := s.storage.listUnreported()
+	if err != nil {
+		slog.Error("Failed to list quarantined fragments", "err", err)
+	}
+	s.mu.Lock()
+	s.corrupt = append(s.corrupt, unreported...)
+	s.mu.Unlock()
+
+	for {
+		if err := s.scrub(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Scrub failed", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.cfg.Interval):
+		}
+	}
+}
+
+// Corrupt returns the IDs of fragments quarantined and not reported yet.
+func (s *Scrubber) Corrupt() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.corrupt))
+	for _, obj := range s.corrupt {
+		ids = append(ids, obj.name)
+	}
+
+	return ids
+}
+
+// Reported marks the quarantined fragments as reported once the cluster has been told about them.
+func (s *Scrubber) Reported(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.corrupt = slices.DeleteFunc(s.corrupt, func(obj quarantinedObject) bool {
+		if !slices.Contains(ids, obj.name) {
+			return false
+		}
+		if err := markReported(obj.path); err != nil {
+			slog.Warn("Failed to mark quarantined fragment reported", "object", obj.name, "err", err)
+		}
+		return true
+	})
+}
+
+func (s *Scrubber) scrub(ctx context.Context) error {
+	start := time.Now()
+	var checked, corrupt int
+	var bytesRead int64
+
+	err := s.storage.ListObjects(ctx, func(entry model.ObjectEntry) error {
+		objectName := entry.Name
+
+		n, ok, err := s.storage.verifyObject(ctx, objectName, s.limiter)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			slog.Warn("Failed to scrub fragment", "object", objectName, "err", err)
+			return nil
+		}
+		checked++
+		bytesRead += n
+		if ok {
+			return nil
+		}
+
+		quarantinePath, err := s.storage.quarantineObject(objectName)
+		if err != nil {
+			slog.Error("Failed to quarantine corrupt fragment", "object", objectName, "err", err)
+			return nil
+		}
+		slog.Warn("Corrupt fragment quarantined", "object", objectName)
+		corrupt++
+
+		s.mu.Lock()
+		s.corrupt = append(s.corrupt, quarantinedObject{name: objectName, path: quarantinePath})
+		s.mu.Unlock()
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Scrub finished", "fragments", checked, "bytes", bytesRead, "corrupt", corrupt,
+		"duration", time.Since(start))
+
+	return nil
+}
+
+// verifyObject reads the object at the pace the limiter allows and compares its content with the stored checksum.
+// It returns the number of bytes read and whether the object is intact. Objects without a checksum,
+// and objects replaced while being read, are reported intact.
+func (s *ObjectStorage) verifyObject(
+	ctx context.Context, objectName string, limiter *rate.Limiter,
+) (int64, bool, error) {
+	filePath := s.getFilePath(objectName)
+	checksumPath := filePath + checksumFileSuffix
+
+	expected, err := os.ReadFile(checksumPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, true, nil
+		}
+		return 0, false, fmt.Errorf("failed to read checksum file %s: %w", checksumPath, err)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, true, nil
+		}
+		return 0, false, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, ratelimit.NewReader(ctx, file, limiter))
+	if err != nil {
+		return n, false, fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) == string(expected) {
+		return n, true, nil
+	}
+
+	// A new version written meanwhile replaces both files, so the mismatch is only trusted
+	// if neither of them changed.
+	current, err := os.ReadFile(checksumPath)
+	if err != nil || string(current) != string(expected) {
+		return n, true, nil
+	}
+	replaced, err := isReplaced(file, filePath)
+	if err != nil || replaced {
+		return n, true, nil
+	}
+
+	return n, false, nil
+}
+
+// quarantineObject moves the object and its checksum file to the quarantine directory, where they are kept
+// for inspection but no longer served, and returns the new path of the object.
+func (s *ObjectStorage) quarantineObject(objectName string) (string, error) {
+	dir := filepath.Join(s.storagePath, quarantineDirName)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory %s: %w", dir, err)
+	}
+
+	filePath := s.getFilePath(objectName)
+	quarantinePath := filepath.Join(dir, objectName+"-"+strconv.FormatInt(time.Now().UnixNano(), 10))
+
+	if err := os.Rename(filePath, quarantinePath); err != nil {
+		return "", fmt.Errorf("failed to move %s to %s: %w", filePath, quarantinePath, err)
+	}
+
+	checksumPath := filePath + checksumFileSuffix
+	err := os.Rename(checksumPath, quarantinePath+checksumFileSuffix)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to move checksum file %s: %w", checksumPath, err)
+	}
+
+	if err := syncDir(filepath.Dir(filePath)); err != nil {
+		return "", fmt.Errorf("failed to sync directory of %s: %w", filePath, err)
+	}
+	if err := syncDir(dir); err != nil {
+		return "", fmt.Errorf("failed to sync quarantine directory %s: %w", dir, err)
+	}
+
+	return quarantinePath, nil
+}
+
+// listUnreported returns the quarantined objects not marked as reported.
+func (s *ObjectStorage) listUnreported() ([]quarantinedObject, error) {
+	dir := filepath.Join(s.storagePath, quarantineDirName)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read quarantine directory %s: %w", dir, err)
+	}
+
+	var objects []quarantinedObject
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasSuffix(name, checksumFileSuffix) || strings.HasSuffix(name, reportedFileSuffix) {
+			continue
+		}
+
+		// Quarantined objects are named by the object name followed by the time they were quarantined at.
+		i := strings.LastIndex(name, "-")
+		if i <= 0 {
+			continue
+		}
+
+		objects = append(objects, quarantinedObject{name: name[:i], path: filepath.Join(dir, name)})
+	}
+
+	return objects, nil
+}
+
+// markReported renames the quarantined object, so it isn't reported again after a restart.
+func markReported(path string) error {
+	if err := os.Rename(path, path+reportedFileSuffix); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", path, err)
+	}
+
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("failed to sync directory of %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// isReplaced reports whether the path no longer points at the open file.
+func isReplaced(file *os.File, path string) (bool, error) {
+	opened, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	current, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return !os.SameFile(opened, current), nil
+}
@@ -7,27 +7,42 @@ import (
 	"github.com/ssimpl/simple-storage/pkg/storage"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 )
 
 const connectionTimeout = time.Second * 10
 
+// keepaliveMinTime is the minimum period of client pings keeping connections alive.
+const keepaliveMinTime = time.Second * 10
+
 type Server struct {
 	addr   string
 	server *grpc.Server
+	health *health.Server
 }
 
 func NewServer(addr string, storageSrv storage.StorageServer) *Server {
 	server := grpc.NewServer(
 		grpc.ConnectionTimeout(connectionTimeout),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             keepaliveMinTime,
+			PermitWithoutStream: true,
+		}),
 	)
 
+	healthSrv := health.NewServer()
+
 	storage.RegisterStorageServer(server, storageSrv)
+	healthpb.RegisterHealthServer(server, healthSrv)
 	reflection.Register(server)
 
 	return &Server{
 		addr:   addr,
 		server: server,
+		health: healthSrv,
 	}
 }
 
@@ -39,6 +54,8 @@ func (s *Server) Start() error {
 	return s.server.Serve(listener)
 }
 
+// Stop reports the server as not serving to health checks, then waits for pending calls to finish.
 func (s *Server) Stop() {
+	s.health.Shutdown()
 	s.server.GracefulStop()
 }
@@ -0,0 +1,40 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ssimpl/simple-storage/internal/storage/model"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatusError converts an error to a gRPC status error, so clients can tell
+// bad requests and lost data from transient failures.
+func toStatusError(err error) error {
+	code := codes.Internal
+
+	switch {
+	case errors.Is(err, model.ErrObjectNameRequired), errors.Is(err, model.ErrInvalidObjectName):
+		code = codes.InvalidArgument
+	case errors.Is(err, model.ErrObjectNotFound):
+		code = codes.NotFound
+	case errors.Is(err, model.ErrInvalidRange):
+		code = codes.OutOfRange
+	case errors.Is(err, model.ErrSizeMismatch), errors.Is(err, model.ErrChecksumMismatch):
+		code = codes.DataLoss
+	case errors.Is(err, model.ErrUploadNotCommitted):
+		code = codes.Aborted
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	default:
+		if s, ok := status.FromError(err); ok {
+			code = s.Code()
+		}
+	}
+
+	return status.Error(code, err.Error())
+}
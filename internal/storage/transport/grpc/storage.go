@@ -10,16 +10,24 @@ import (
 	"github.com/ssimpl/simple-storage/internal/storage/model"
 	"github.com/ssimpl/simple-storage/pkg/storage"
 
+	"github.com/google/uuid"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 const statusOK = "OK"
 
 const bufferSize = 64000
 
+// listBatchSize is the number of fragments sent per message when listing them.
+const listBatchSize = 1000
+
 type objectStorage interface {
-	StoreObject(ctx context.Context, objectName string, src io.Reader) error
-	RetrieveObject(ctx context.Context, objectName string, dst io.Writer) error
+	StoreObject(ctx context.Context, objectName string, src io.Reader, commit func() model.ObjectCommit) error
+	RetrieveObject(ctx context.Context, objectName string, offset, length int64, dst io.Writer) error
+	DeleteObject(ctx context.Context, objectName string) error
+	StatObject(ctx context.Context, objectName string) (model.ObjectInfo, error)
+	ListObjects(ctx context.Context, fn func(entry model.ObjectEntry) error) error
 }
 
 type StorageServer struct {
@@ -37,35 +45,56 @@ func NewStorageServer(storage objectStorage) *StorageServer {
 func (s *StorageServer) Upload(stream grpc.ClientStreamingServer[storage.UploadRequest, storage.UploadResponse]) error {
 	req, err := stream.Recv()
 	if err != nil {
-		return fmt.Errorf("failed to receive initial upload request: %w", err)
+		return toStatusError(fmt.Errorf("failed to receive initial upload request: %w", err))
 	}
 
-	objectName := req.GetObjectId()
-	if objectName == "" {
-		return model.ErrObjectNameRequired
+	objectName, err := parseObjectName(req.GetObjectId())
+	if err != nil {
+		return toStatusError(err)
 	}
 
+	var commit *storage.UploadCommit
+
 	pipeReader, pipeWriter := io.Pipe()
+	defer pipeReader.Close()
+
 	go func() {
-		defer pipeWriter.Close()
+		data := req.GetData()
 		for {
-			req, err := stream.Recv()
+			if len(data) > 0 {
+				if _, err := pipeWriter.Write(data); err != nil {
+					slog.Error("failed to write chunk data to pipe", "err", err)
+					return
+				}
+			}
+
+			chunk, err := stream.Recv()
 			if errors.Is(err, io.EOF) {
+				pipeWriter.CloseWithError(model.ErrUploadNotCommitted)
 				return
 			}
 			if err != nil {
 				slog.Error("failed to receive upload chunk", "err", err)
+				pipeWriter.CloseWithError(err)
 				return
 			}
-			if _, err := pipeWriter.Write(req.GetData()); err != nil {
-				slog.Error("failed to write chunk data to pipe", "err", err)
+			if c := chunk.GetCommit(); c != nil {
+				commit = c
+				pipeWriter.Close()
 				return
 			}
+			data = chunk.GetData()
 		}
 	}()
 
-	if err := s.storage.StoreObject(stream.Context(), objectName, pipeReader); err != nil {
-		return fmt.Errorf("failed to store object: %w", err)
+	err = s.storage.StoreObject(stream.Context(), objectName, pipeReader, func() model.ObjectCommit {
+		return model.ObjectCommit{
+			Size:     req.GetSize(),
+			Checksum: commit.GetChecksum(),
+		}
+	})
+	if err != nil {
+		return toStatusError(fmt.Errorf("failed to store object: %w", err))
 	}
 
 	return stream.SendAndClose(&storage.UploadResponse{
@@ -76,15 +105,18 @@ func (s *StorageServer) Upload(stream grpc.ClientStreamingServer[storage.UploadR
 func (s *StorageServer) Download(
 	req *storage.DownloadRequest, stream grpc.ServerStreamingServer[storage.DownloadResponse],
 ) error {
-	objectName := req.GetObjectId()
-	if objectName == "" {
-		return model.ErrObjectNameRequired
+	objectName, err := parseObjectName(req.GetObjectId())
+	if err != nil {
+		return toStatusError(err)
 	}
 
 	pipeReader, pipeWriter := io.Pipe()
+	defer pipeReader.Close()
+
 	go func() {
 		defer pipeWriter.Close()
-		if err := s.storage.RetrieveObject(stream.Context(), objectName, pipeWriter); err != nil {
+		err := s.storage.RetrieveObject(stream.Context(), objectName, req.GetOffset(), req.GetLength(), pipeWriter)
+		if err != nil {
 			slog.Error("failed to retrieve object", "err", err)
 			pipeWriter.CloseWithError(err)
 		}
@@ -97,14 +129,103 @@ func (s *StorageServer) Download(
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("failed to read chunk data from pipe: %w", err)
+			return toStatusError(fmt.Errorf("failed to read chunk data from pipe: %w", err))
 		}
 
 		err = stream.Send(&storage.DownloadResponse{
 			Data: buffer[:n],
 		})
 		if err != nil {
-			return fmt.Errorf("failed to send chunk data: %w", err)
+			return toStatusError(fmt.Errorf("failed to send chunk data: %w", err))
+		}
+	}
+
+	return nil
+}
+
+func (s *StorageServer) Delete(ctx context.Context, req *storage.DeleteRequest) (*storage.DeleteResponse, error) {
+	objectName, err := parseObjectName(req.GetObjectId())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	if err := s.storage.DeleteObject(ctx, objectName); err != nil {
+		return nil, toStatusError(fmt.Errorf("failed to delete object: %w", err))
+	}
+
+	return &storage.DeleteResponse{
+		Status: statusOK,
+	}, nil
+}
+
+func (s *StorageServer) Stat(ctx context.Context, req *storage.StatRequest) (*storage.StatResponse, error) {
+	objectName, err := parseObjectName(req.GetObjectId())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	info, err := s.storage.StatObject(ctx, objectName)
+	if err != nil {
+		return nil, toStatusError(fmt.Errorf("failed to stat object: %w", err))
+	}
+
+	if !info.Exists {
+		return &storage.StatResponse{}, nil
+	}
+
+	return &storage.StatResponse{
+		Exists:   true,
+		Size:     info.Size,
+		ModTime:  timestamppb.New(info.ModTime),
+		Checksum: info.Checksum,
+	}, nil
+}
+
+// parseObjectName returns the object name of a request in canonical form. Object names are fragment IDs:
+// they are turned into file paths, so anything else could reach outside the storage path.
+func parseObjectName(objectID string) (string, error) {
+	if objectID == "" {
+		return "", model.ErrObjectNameRequired
+	}
+
+	id, err := uuid.Parse(objectID)
+	if err != nil {
+		return "", fmt.Errorf("object id %q: %w", objectID, model.ErrInvalidObjectName)
+	}
+
+	return id.String(), nil
+}
+
+func (s *StorageServer) ListFragments(
+	_ *storage.ListFragmentsRequest, stream grpc.ServerStreamingServer[storage.ListFragmentsResponse],
+) error {
+	batch := make([]*storage.FragmentEntry, 0, listBatchSize)
+	send := func() error {
+		if err := stream.Send(&storage.ListFragmentsResponse{Fragments: batch}); err != nil {
+			return fmt.Errorf("failed to send fragments: %w", err)
+		}
+		batch = make([]*storage.FragmentEntry, 0, listBatchSize)
+		return nil
+	}
+
+	err := s.storage.ListObjects(stream.Context(), func(entry model.ObjectEntry) error {
+		batch = append(batch, &storage.FragmentEntry{
+			ObjectId: entry.Name,
+			Size:     entry.Size,
+			ModTime:  timestamppb.New(entry.ModTime),
+		})
+		if len(batch) < listBatchSize {
+			return nil
+		}
+		return send()
+	})
+	if err != nil {
+		return toStatusError(fmt.Errorf("failed to list objects: %w", err))
+	}
+
+	if len(batch) > 0 {
+		if err := send(); err != nil {
+			return toStatusError(err)
 		}
 	}
 
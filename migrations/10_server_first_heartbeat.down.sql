@@ -0,0 +1,2 @@
+ALTER TABLE servers
+DROP COLUMN IF EXISTS first_heartbeat_at;
@@ -0,0 +1,3 @@
+-- Left NULL for servers registered before, so garbage collection waits a grace period after the upgrade.
+ALTER TABLE servers
+ADD COLUMN IF NOT EXISTS first_heartbeat_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+ALTER TABLE servers
+ADD COLUMN IF NOT EXISTS static BOOLEAN NOT NULL DEFAULT FALSE;
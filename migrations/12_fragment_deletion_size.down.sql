@@ -0,0 +1,2 @@
+ALTER TABLE fragment_deletions
+DROP COLUMN IF EXISTS size_unknown;
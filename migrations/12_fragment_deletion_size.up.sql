@@ -0,0 +1,2 @@
+ALTER TABLE fragment_deletions
+ADD COLUMN IF NOT EXISTS size_unknown BOOLEAN NOT NULL DEFAULT FALSE;
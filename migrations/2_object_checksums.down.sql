@@ -0,0 +1,3 @@
+ALTER TABLE objects_metadata
+DROP COLUMN IF EXISTS size,
+DROP COLUMN IF EXISTS checksum;
@@ -0,0 +1,3 @@
+ALTER TABLE objects_metadata
+ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS checksum TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE objects_metadata
+DROP COLUMN IF EXISTS layout;
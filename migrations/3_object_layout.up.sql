@@ -0,0 +1,2 @@
+ALTER TABLE objects_metadata
+ADD COLUMN IF NOT EXISTS layout JSONB NOT NULL DEFAULT '{}';
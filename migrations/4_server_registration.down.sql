@@ -0,0 +1,6 @@
+ALTER TABLE servers
+DROP CONSTRAINT IF EXISTS servers_addr_key,
+DROP COLUMN IF EXISTS capacity,
+DROP COLUMN IF EXISTS labels,
+DROP COLUMN IF EXISTS last_heartbeat_at,
+DROP COLUMN IF EXISTS stale;
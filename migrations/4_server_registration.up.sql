@@ -0,0 +1,15 @@
+-- Storage servers register themselves now: drop the seeded ones that never stored anything.
+DELETE FROM servers
+WHERE used_space = 0
+    AND NOT EXISTS (
+        SELECT 1
+        FROM objects_metadata o, jsonb_array_elements(o.fragments) f
+        WHERE f->>'server_id' = servers.id::text
+    );
+
+ALTER TABLE servers
+ADD COLUMN IF NOT EXISTS capacity BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS last_heartbeat_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS stale BOOLEAN NOT NULL DEFAULT FALSE,
+ADD CONSTRAINT servers_addr_key UNIQUE (addr);
@@ -0,0 +1,2 @@
+ALTER TABLE servers
+ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS fragment_moves (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    object_name TEXT NOT NULL,
+    seq_num INT NOT NULL,
+    fragment_id UUID NOT NULL,
+    fragment_size BIGINT NOT NULL,
+    checksum TEXT NOT NULL DEFAULT '',
+    source_server_id UUID NOT NULL,
+    target_server_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    state TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- A fragment copy is moved by at most one unfinished move at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS fragment_moves_fragment_key
+ON fragment_moves (fragment_id, source_server_id)
+WHERE state <> 'failed';
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS repairs (
+    object_name TEXT PRIMARY KEY,
+    missing INT NOT NULL,
+    repaired INT NOT NULL DEFAULT 0,
+    state TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
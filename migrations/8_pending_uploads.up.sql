@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS pending_uploads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    object_name TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    fragments JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS pending_uploads_updated_at_idx ON pending_uploads (updated_at);
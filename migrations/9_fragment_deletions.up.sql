@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS fragment_deletions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid (),
+    object_name TEXT NOT NULL,
+    server_id UUID NOT NULL,
+    fragment_id UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS fragment_deletions_created_at_idx ON fragment_deletions (created_at);
@@ -0,0 +1,3 @@
+package registry
+
+//go:generate protoc --go_out=. --go-grpc_out=. registry.proto